@@ -0,0 +1,21 @@
+package commons
+
+import (
+	"syscall"
+	"time"
+)
+
+// ChangeTime returns the last status change time of the file, the second
+// value is false when the platform does not expose it.
+func (info *Stats) ChangeTime() (time.Time, bool) {
+	if info == nil || info.FileInfo == nil {
+		return time.Time{}, false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(stat.Ctim.Unix()), true
+}
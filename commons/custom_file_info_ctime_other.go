@@ -0,0 +1,9 @@
+//go:build !linux
+
+package commons
+
+import "time"
+
+func (info *Stats) ChangeTime() (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package commons
+
+func (info *Stats) DeviceID() (uint64, bool) {
+	return 0, false
+}
+
+func (info *Stats) Owner() (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+func (info *Stats) Inode() (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,50 @@
+//go:build unix
+
+package commons
+
+import "syscall"
+
+// DeviceID returns the identifier of the device holding the file, the second
+// value is false when the platform does not expose it.
+func (info *Stats) DeviceID() (uint64, bool) {
+	if info == nil || info.FileInfo == nil {
+		return 0, false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(stat.Dev), true //nolint:unconvert // Dev is not uint64 on every unix
+}
+
+// Owner returns the user and group ids owning the file, the third value is
+// false when the platform does not expose them.
+func (info *Stats) Owner() (uint32, uint32, bool) {
+	if info == nil || info.FileInfo == nil {
+		return 0, 0, false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return stat.Uid, stat.Gid, true
+}
+
+// Inode returns the file serial number on its device, the second value is
+// false when the platform does not expose it.
+func (info *Stats) Inode() (uint64, bool) {
+	if info == nil || info.FileInfo == nil {
+		return 0, false
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(stat.Ino), true //nolint:unconvert // Ino is not uint64 on every unix
+}
@@ -5,21 +5,51 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	datastructures "archive-tools-monorepo/dataStructures"
 )
 
 var sizesArray = [...]string{"b", "Kb", "Mb", "Gb"}
 
+const defaultHashWidth = 40
+
+// sizeMultipliers maps the units accepted by ParseFileSize, decimal units
+// are powers of 1000 and binary ones powers of 1024.
+var sizeMultipliers = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"m":   1e6,
+	"mb":  1e6,
+	"g":   1e9,
+	"gb":  1e9,
+	"t":   1e12,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
 type FileSize struct {
 	Unit  *string
 	Value int16
 }
 
+// File is one file found by a scan, Links are its other paths sharing the
+// same device and inode: hardlinks count as a single file.
 type File struct {
-	Hash datastructures.Constant[string]
-	Name string
-	Size int64
+	ModTime    time.Time
+	ChangeTime time.Time
+	Hash       datastructures.Constant[string]
+	Name       string
+	Root       string
+	Links      []string
+	Size       int64
+	Device     uint64
+	Inode      uint64
 }
 
 func (file *File) Format(f fmt.State, _ rune) {
@@ -39,7 +69,14 @@ func (file *File) Format(f fmt.State, _ rune) {
 	}
 }
 
+// ToString pads the hash to the width of a SHA-1 digest.
 func (file *File) ToString() (string, error) {
+	return file.ToStringWithWidth(defaultHashWidth)
+}
+
+// ToStringWithWidth pads the hash to hashWidth characters so that the
+// following columns stay aligned whatever the hash algorithm.
+func (file *File) ToStringWithWidth(hashWidth int) (string, error) {
 	var b strings.Builder
 
 	if file.Hash.Ptr() == nil {
@@ -47,7 +84,7 @@ func (file *File) ToString() (string, error) {
 	}
 
 	b.WriteString(file.Hash.Value())
-	for range 40 - len(file.Hash.Value()) {
+	for range hashWidth - len(file.Hash.Value()) {
 		b.WriteByte(' ')
 	}
 	b.WriteByte(' ')
@@ -83,11 +120,15 @@ func (file *File) HashDescending(b *File) bool {
 		return false
 	}
 
-	if file.Hash.Ptr() == b.Hash.Ptr() {
-		return true
+	if file.Hash.Ptr() != b.Hash.Ptr() && file.Hash.Value() != b.Hash.Value() {
+		return file.Hash.Value() < b.Hash.Value()
 	}
 
-	return file.Hash.Value() <= b.Hash.Value() || (file.Size < b.Size || file.Name < b.Name)
+	if file.Size != b.Size {
+		return file.Size < b.Size
+	}
+
+	return file.Name <= b.Name
 }
 
 func (file *File) Equal(other *File) bool {
@@ -118,6 +159,30 @@ func StrongFileEquality(f1, f2 *File) bool {
 	return f1.Equal(f2)
 }
 
+// ParseFileSize reads a size such as 4096, 10M, 1.5GB or 2GiB.
+func ParseFileSize(text string) (int64, error) {
+	trimmed := strings.TrimSpace(text)
+	unitStart := strings.IndexFunc(trimmed, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	if unitStart < 0 {
+		unitStart = len(trimmed)
+	}
+
+	multiplier, found := sizeMultipliers[strings.ToLower(strings.TrimSpace(trimmed[unitStart:]))]
+	if !found {
+		return 0, fmt.Errorf("%w: unknown size unit in %s", os.ErrInvalid, text)
+	}
+
+	value, err := strconv.ParseFloat(trimmed[:unitStart], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad size %s", os.ErrInvalid, text)
+	}
+
+	return int64(value * multiplier), nil
+}
+
 func FormatFileSize(size int64) (FileSize, error) {
 	if size < 0 {
 		return FileSize{}, fmt.Errorf("%w: size is negative", os.ErrInvalid)
@@ -1,7 +1,9 @@
 package commons_test
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 
@@ -55,3 +57,59 @@ func TestFile_FormatFileSize_NegativeSize_Error(t *testing.T) {
 		t.Errorf("expected error to be \"invalid argument: size is negative\", got %v", err)
 	}
 }
+
+func TestFile_ToStringWithWidth_ShortHash_Padded(t *testing.T) {
+	myHashValue := "44bc2cf5ad770999"
+	myHash, err := datastructures.NewConstant(&myHashValue)
+	if err != nil {
+		panic(err)
+	}
+
+	myFile := commons.File{
+		Name: "my/path/test",
+		Hash: myHash,
+		Size: 10,
+	}
+
+	expected := "44bc2cf5ad770999   10  b my/path/test"
+	actual, err := myFile.ToStringWithWidth(16)
+	if err != nil {
+		panic(err)
+	}
+
+	if expected != actual {
+		t.Errorf("expecting \"%v\", got \"%v\"", expected, actual)
+	}
+}
+
+func TestFile_ParseFileSize_Units(t *testing.T) {
+	expected := map[string]int64{
+		"4096":   4096,
+		"10M":    10_000_000,
+		"100 MB": 100_000_000,
+		"1.5k":   1500,
+		"2GiB":   2 << 30,
+		"1tib":   1 << 40,
+		"7b":     7,
+	}
+
+	for text, size := range expected {
+		parsed, err := commons.ParseFileSize(text)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", text, err)
+		}
+
+		if parsed != size {
+			t.Errorf("%s: expected %d, got %d", text, size, parsed)
+		}
+	}
+}
+
+func TestFile_ParseFileSize_Invalid_Error(t *testing.T) {
+	for _, text := range []string{"", "M", "10X", "1..2G", "-5"} {
+		_, err := commons.ParseFileSize(text)
+		if !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("%s: expected invalid argument error, got %v", text, err)
+		}
+	}
+}
@@ -2,13 +2,76 @@ package commons
 
 import (
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 )
 
+const (
+	SHA1Hash   = "sha1"
+	SHA256Hash = "sha256"
+	XXH64Hash  = "xxh64"
+)
+
+// Hasher computes the content digest used to tell files apart, Width is the
+// length of the hex encoded digest. HashHeadTailFromPath only reads the
+// first and last blockSize bytes, files not larger than two blocks are read
+// whole and get the same digest as HashFromPath.
+type Hasher interface {
+	Name() string
+	Width() int
+	HashFromPath(filepath string) (string, error)
+	HashHeadTailFromPath(filepath string, blockSize int64) (string, error)
+}
+
+type digestHasher struct {
+	newFn func() hash.Hash
+	name  string
+}
+
+func NewHasher(name string) (Hasher, error) {
+	switch name {
+	case SHA1Hash:
+		return &digestHasher{newFn: sha1.New, name: name}, nil
+	case SHA256Hash:
+		return &digestHasher{newFn: sha256.New, name: name}, nil
+	case XXH64Hash:
+		return &digestHasher{newFn: func() hash.Hash { return NewXXHash64() }, name: name}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %s", os.ErrInvalid, name)
+	}
+}
+
+func (hasher *digestHasher) Name() string {
+	return hasher.name
+}
+
+func (hasher *digestHasher) Width() int {
+	return hex.EncodedLen(hasher.newFn().Size())
+}
+
+func (hasher *digestHasher) HashFromPath(filepath string) (string, error) {
+	return getHashFromPath(filepath, hasher.newFn(), 0)
+}
+
+func (hasher *digestHasher) HashHeadTailFromPath(filepath string, blockSize int64) (string, error) {
+	if blockSize <= 0 {
+		return "", fmt.Errorf("%w: block size is not positive", os.ErrInvalid)
+	}
+
+	return getHashFromPath(filepath, hasher.newFn(), blockSize)
+}
+
 func GetSHA1HashFromPath(filepath string) (string, error) {
+	return getHashFromPath(filepath, sha1.New(), 0)
+}
+
+// getHashFromPath digests the whole file when blockSize is 0 or the file fits
+// in two blocks, otherwise only its first and last blocks.
+func getHashFromPath(filepath string, digest hash.Hash, blockSize int64) (string, error) {
 	if filepath == "" {
 		return "", fmt.Errorf("%w: empty filepath", os.ErrInvalid)
 	}
@@ -40,11 +103,18 @@ func GetSHA1HashFromPath(filepath string) (string, error) {
 		return "", fmt.Errorf("%w: file size is not positive", os.ErrInvalid)
 	}
 
-	sha1h := sha1.New()
-	_, err = io.Copy(sha1h, filePointer)
+	if blockSize == 0 || size <= 2*blockSize {
+		_, err = io.Copy(digest, filePointer)
+	} else {
+		_, err = io.Copy(digest, io.MultiReader(
+			io.NewSectionReader(filePointer, 0, blockSize),
+			io.NewSectionReader(filePointer, size-blockSize, blockSize),
+		))
+	}
+
 	if err != nil {
 		return "", fmt.Errorf("error while generating hash: %w", err)
 	}
 
-	return hex.EncodeToString(sha1h.Sum(nil)), nil
+	return hex.EncodeToString(digest.Sum(nil)), nil
 }
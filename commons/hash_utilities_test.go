@@ -0,0 +1,134 @@
+package commons_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"archive-tools-monorepo/commons"
+)
+
+func TestHasher_HashFromPath_KnownDigests_Ok(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "abc")
+	err := os.WriteFile(filePath, []byte("abc"), 0o600)
+	if err != nil {
+		panic(err)
+	}
+
+	expectations := map[string]string{
+		commons.SHA1Hash:   "a9993e364706816aba3e25717850c26c9cd0d89d",
+		commons.SHA256Hash: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		commons.XXH64Hash:  "44bc2cf5ad770999",
+	}
+
+	for name, expected := range expectations {
+		hasher, err := commons.NewHasher(name)
+		if err != nil {
+			panic(err)
+		}
+
+		actual, err := hasher.HashFromPath(filePath)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", name, err)
+		}
+
+		if actual != expected {
+			t.Errorf("%s: expecting \"%v\", got \"%v\"", name, expected, actual)
+		}
+
+		if hasher.Width() != len(expected) {
+			t.Errorf("%s: expecting width %d, got %d", name, len(expected), hasher.Width())
+		}
+	}
+}
+
+func TestHasher_NewHasher_Unsupported_Error(t *testing.T) {
+	_, err := commons.NewHasher("md4")
+
+	if !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("expected invalid argument error, got %v", err)
+	}
+}
+
+func TestXXHash64_Sum64_ReferenceVectors_Ok(t *testing.T) {
+	vectors := map[string]uint64{
+		"":    0xef46db3751d8e999,
+		"a":   0xd24ec4f1a98c6e5b,
+		"abc": 0x44bc2cf5ad770999,
+		"Nobody inspects the spammish repetition": 0xfbcea83c8a378bf1,
+	}
+
+	for input, expected := range vectors {
+		digest := commons.NewXXHash64()
+		_, _ = digest.Write([]byte(input))
+
+		if digest.Sum64() != expected {
+			t.Errorf("%q: expecting %016x, got %016x", input, expected, digest.Sum64())
+		}
+	}
+}
+
+func TestXXHash64_Write_SplitInput_SameDigest(t *testing.T) {
+	data := make([]byte, 1000)
+	for index := range data {
+		data[index] = byte(index * 7)
+	}
+
+	whole := commons.NewXXHash64()
+	_, _ = whole.Write(data)
+
+	for _, chunkSize := range []int{1, 3, 31, 32, 33, 100} {
+		split := commons.NewXXHash64()
+
+		for start := 0; start < len(data); start += chunkSize {
+			_, _ = split.Write(data[start:min(start+chunkSize, len(data))])
+		}
+
+		if split.Sum64() != whole.Sum64() {
+			t.Errorf("chunk size %d: expecting %016x, got %016x", chunkSize, whole.Sum64(), split.Sum64())
+		}
+	}
+}
+
+func TestHasher_HashHeadTailFromPath_IgnoresMiddle(t *testing.T) {
+	baseDir := t.TempDir()
+	first := make([]byte, 3000)
+	second := make([]byte, 3000)
+	second[1500] = 1
+
+	for name, data := range map[string][]byte{"first": first, "second": second, "small": []byte("abc")} {
+		err := os.WriteFile(filepath.Join(baseDir, name), data, 0o600)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	hasher, err := commons.NewHasher(commons.SHA1Hash)
+	if err != nil {
+		panic(err)
+	}
+
+	firstHash, err := hasher.HashHeadTailFromPath(filepath.Join(baseDir, "first"), 1000)
+	if err != nil {
+		panic(err)
+	}
+
+	secondHash, err := hasher.HashHeadTailFromPath(filepath.Join(baseDir, "second"), 1000)
+	if err != nil {
+		panic(err)
+	}
+
+	if firstHash != secondHash {
+		t.Errorf("expected equal head/tail hashes, got %v and %v", firstHash, secondHash)
+	}
+
+	smallHash, err := hasher.HashHeadTailFromPath(filepath.Join(baseDir, "small"), 1000)
+	if err != nil {
+		panic(err)
+	}
+
+	if smallHash != "a9993e364706816aba3e25717850c26c9cd0d89d" {
+		t.Errorf("expected small file to be hashed whole, got %v", smallHash)
+	}
+}
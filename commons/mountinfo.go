@@ -0,0 +1,125 @@
+package commons
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MountInfoPath lists the mount points seen by the process on Linux.
+const MountInfoPath = "/proc/self/mountinfo"
+
+type MountPoint struct {
+	Path   string
+	FSType string
+	Device uint64
+}
+
+// MakeDevice encodes a major and minor device number like the st_dev field of
+// a Linux stat.
+func MakeDevice(major uint32, minor uint32) uint64 {
+	device := (uint64(major) & 0x00000fff) << 8
+	device |= (uint64(major) & 0xfffff000) << 32
+	device |= uint64(minor) & 0x000000ff
+	device |= (uint64(minor) & 0xffffff00) << 12
+
+	return device
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for a space) of mountinfo
+// paths.
+func unescapeMountPath(path string) string {
+	var builder strings.Builder
+
+	for index := 0; index < len(path); index++ {
+		if path[index] == '\\' && index+3 < len(path) {
+			value, err := strconv.ParseUint(path[index+1:index+4], 8, 8)
+			if err == nil {
+				builder.WriteByte(byte(value))
+				index += 3
+
+				continue
+			}
+		}
+
+		builder.WriteByte(path[index])
+	}
+
+	return builder.String()
+}
+
+func parseMountInfoLine(line string) (MountPoint, error) {
+	fields := strings.Fields(line)
+
+	separator := -1
+	for index := 6; index < len(fields); index++ {
+		if fields[index] == "-" {
+			separator = index
+			break
+		}
+	}
+
+	if len(fields) < 7 || separator < 0 || separator+1 >= len(fields) {
+		return MountPoint{}, fmt.Errorf("%w: bad mountinfo line %q", os.ErrInvalid, line)
+	}
+
+	major, minor, found := strings.Cut(fields[2], ":")
+	majorNumber, majorErr := strconv.ParseUint(major, 10, 32)
+	minorNumber, minorErr := strconv.ParseUint(minor, 10, 32)
+
+	if !found || majorErr != nil || minorErr != nil {
+		return MountPoint{}, fmt.Errorf("%w: bad device in mountinfo line %q", os.ErrInvalid, line)
+	}
+
+	return MountPoint{
+		Path:   unescapeMountPath(fields[4]),
+		FSType: fields[separator+1],
+		Device: MakeDevice(uint32(majorNumber), uint32(minorNumber)),
+	}, nil
+}
+
+// ParseMountInfo reads mount points in the /proc/self/mountinfo format.
+func ParseMountInfo(reader io.Reader) ([]MountPoint, error) {
+	mounts := make([]MountPoint, 0)
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		mount, err := parseMountInfoLine(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+
+		mounts = append(mounts, mount)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error while reading mount points: %w", err)
+	}
+
+	return mounts, nil
+}
+
+// LoadMountPoints returns the mount points of the process, no mount point and
+// no error when the platform has no mountinfo.
+func LoadMountPoints() ([]MountPoint, error) {
+	file, err := os.Open(MountInfoPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return []MountPoint{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error while reading mount points: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return ParseMountInfo(file)
+}
@@ -0,0 +1,35 @@
+package commons_test
+
+import (
+	"os"
+	"testing"
+
+	"archive-tools-monorepo/commons"
+)
+
+func TestMountInfo_LoadMountPoints_RootDeviceMatchesStat(t *testing.T) {
+	mounts, err := commons.LoadMountPoints()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	infos, err := os.Stat("/proc")
+	if err != nil {
+		t.Skip("no /proc:", err)
+	}
+
+	stats := commons.Stats{FileInfo: infos}
+	device, _ := stats.DeviceID()
+
+	for _, mount := range mounts {
+		if mount.Path == "/proc" {
+			if mount.Device != device || mount.FSType != "proc" {
+				t.Errorf("expected proc on device %#x, got %+v", device, mount)
+			}
+
+			return
+		}
+	}
+
+	t.Skip("/proc is not a mount point")
+}
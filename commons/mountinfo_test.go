@@ -0,0 +1,55 @@
+package commons_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"archive-tools-monorepo/commons"
+)
+
+func TestMountInfo_ParseMountInfo_Fields(t *testing.T) {
+	input := strings.Join([]string{
+		"23 28 0:22 / /proc rw,relatime - proc proc rw",
+		"36 35 98:0 /mnt1 /mnt/my\\040disk rw,noatime master:1 shared:2 - ext4 /dev/root rw",
+		"",
+		"40 28 0:45 / /home/user/remote rw - fuse.sshfs user@host: rw",
+	}, "\n")
+
+	mounts, err := commons.ParseMountInfo(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []commons.MountPoint{
+		{Path: "/proc", FSType: "proc", Device: commons.MakeDevice(0, 22)},
+		{Path: "/mnt/my disk", FSType: "ext4", Device: commons.MakeDevice(98, 0)},
+		{Path: "/home/user/remote", FSType: "fuse.sshfs", Device: commons.MakeDevice(0, 45)},
+	}
+
+	if len(mounts) != len(expected) {
+		t.Fatalf("expected %d mount points, got %d", len(expected), len(mounts))
+	}
+
+	for index := range expected {
+		if mounts[index] != expected[index] {
+			t.Errorf("mount %d: expected %+v, got %+v", index, expected[index], mounts[index])
+		}
+	}
+}
+
+func TestMountInfo_ParseMountInfo_BadLine_Error(t *testing.T) {
+	for _, line := range []string{"23 28 0:22 / /proc rw", "23 28 zero / /proc rw - proc proc rw"} {
+		_, err := commons.ParseMountInfo(strings.NewReader(line))
+		if !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("%q: expected invalid argument error, got %v", line, err)
+		}
+	}
+}
+
+func TestMountInfo_MakeDevice_LargeNumbers(t *testing.T) {
+	if device := commons.MakeDevice(0x1234, 0x56789); device != 0x1000_5672_3489 {
+		t.Errorf("unexpected device %#x", device)
+	}
+}
@@ -87,6 +87,25 @@ func (ui *UI) UpdateNamedLine(lineID string, a ...any) {
 	ui.lines[lineID] = currentLine
 }
 
+// SetNamedLine redraws a named line right away, unlike UpdateNamedLine it is
+// not rate limited so it can be used to render interactive screens.
+func (ui *UI) SetNamedLine(lineID string, a ...any) {
+	ui.mutex.Lock()
+	defer ui.mutex.Unlock()
+
+	if ui.silent {
+		return
+	}
+
+	currentLine := ui.lines[lineID]
+	data := fmt.Sprintf(currentLine.format, a...)
+
+	ui.printToNamedLine(data, currentLine.lineNumber)
+
+	currentLine.lastUpdate = time.Now()
+	currentLine.currentLineValue = data
+}
+
 func (ui *UI) Println(format string, a ...any) {
 	ui.mutex.Lock()
 	defer ui.mutex.Unlock()
@@ -0,0 +1,144 @@
+package commons
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	xxhPrime1 uint64 = 0x9E3779B185EBCA87
+	xxhPrime2 uint64 = 0xC2B2AE3D27D4EB4F
+	xxhPrime3 uint64 = 0x165667B19E3779F9
+	xxhPrime4 uint64 = 0x85EBCA77C2B2AE63
+	xxhPrime5 uint64 = 0x27D4EB2F165667C5
+
+	xxhStripeSize = 32
+)
+
+// xxHash64 is a streaming implementation of the XXH64 algorithm with seed 0,
+// a fast non cryptographic digest meant for scratch data.
+type xxHash64 struct {
+	accumulators [4]uint64
+	buffer       [xxhStripeSize]byte
+	total        uint64
+	buffered     int
+}
+
+func NewXXHash64() hash.Hash64 {
+	digest := &xxHash64{}
+	digest.Reset()
+
+	return digest
+}
+
+func xxhRound(accumulator uint64, input uint64) uint64 {
+	accumulator += input * xxhPrime2
+	accumulator = bits.RotateLeft64(accumulator, 31)
+
+	return accumulator * xxhPrime1
+}
+
+func xxhMergeRound(accumulator uint64, value uint64) uint64 {
+	accumulator ^= xxhRound(0, value)
+
+	return accumulator*xxhPrime1 + xxhPrime4
+}
+
+func (digest *xxHash64) Reset() {
+	// the seed is always 0, the accumulators wrap around on purpose
+	prime1, prime2 := xxhPrime1, xxhPrime2
+	digest.accumulators = [4]uint64{prime1 + prime2, prime2, 0, -prime1}
+	digest.total = 0
+	digest.buffered = 0
+}
+
+func (*xxHash64) Size() int {
+	return 8
+}
+
+func (*xxHash64) BlockSize() int {
+	return xxhStripeSize
+}
+
+func (digest *xxHash64) consumeStripe(stripe []byte) {
+	for lane := range digest.accumulators {
+		digest.accumulators[lane] = xxhRound(digest.accumulators[lane], binary.LittleEndian.Uint64(stripe[lane*8:]))
+	}
+}
+
+func (digest *xxHash64) Write(data []byte) (int, error) {
+	written := len(data)
+	digest.total += uint64(written)
+
+	if digest.buffered > 0 {
+		copied := copy(digest.buffer[digest.buffered:], data)
+		digest.buffered += copied
+		data = data[copied:]
+
+		if digest.buffered < xxhStripeSize {
+			return written, nil
+		}
+
+		digest.consumeStripe(digest.buffer[:])
+		digest.buffered = 0
+	}
+
+	for len(data) >= xxhStripeSize {
+		digest.consumeStripe(data[:xxhStripeSize])
+		data = data[xxhStripeSize:]
+	}
+
+	digest.buffered = copy(digest.buffer[:], data)
+
+	return written, nil
+}
+
+func (digest *xxHash64) Sum64() uint64 {
+	var result uint64
+
+	if digest.total >= xxhStripeSize {
+		v1, v2, v3, v4 := digest.accumulators[0], digest.accumulators[1], digest.accumulators[2], digest.accumulators[3]
+		result = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) +
+			bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		result = xxhMergeRound(result, v1)
+		result = xxhMergeRound(result, v2)
+		result = xxhMergeRound(result, v3)
+		result = xxhMergeRound(result, v4)
+	} else {
+		result = xxhPrime5
+	}
+
+	result += digest.total
+
+	tail := digest.buffer[:digest.buffered]
+
+	for len(tail) >= 8 {
+		result ^= xxhRound(0, binary.LittleEndian.Uint64(tail))
+		result = bits.RotateLeft64(result, 27)*xxhPrime1 + xxhPrime4
+		tail = tail[8:]
+	}
+
+	if len(tail) >= 4 {
+		result ^= uint64(binary.LittleEndian.Uint32(tail)) * xxhPrime1
+		result = bits.RotateLeft64(result, 23)*xxhPrime2 + xxhPrime3
+		tail = tail[4:]
+	}
+
+	for _, value := range tail {
+		result ^= uint64(value) * xxhPrime5
+		result = bits.RotateLeft64(result, 11) * xxhPrime1
+	}
+
+	result ^= result >> 33
+	result *= xxhPrime2
+	result ^= result >> 29
+	result *= xxhPrime3
+	result ^= result >> 32
+
+	return result
+}
+
+func (digest *xxHash64) Sum(data []byte) []byte {
+	return binary.BigEndian.AppendUint64(data, digest.Sum64())
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"archive-tools-monorepo/commons"
+)
+
+const (
+	noneActionName       = "none"
+	deleteActionName     = "delete"
+	hardlinkActionName   = "hardlink"
+	symlinkActionName    = "symlink"
+	reflinkActionName    = "reflink"
+	quarantineActionName = "quarantine"
+	removeOperation      = "remove"
+)
+
+const (
+	keepOldest    = "oldest"
+	keepNewest    = "newest"
+	keepShortest  = "shortest"
+	keepPreferred = "prefer"
+)
+
+var (
+	errNoKeeper           = errors.New("no file matches the keep policy")
+	errReflinkUnsupported = errors.New("filesystem does not support reflinks")
+)
+
+// keepPolicy returns the index of the group member that must survive an
+// action, every other member is considered an extra copy.
+type keepPolicy func(files []commons.File) (int, error)
+
+type groupAction interface {
+	Apply(group *duplicateGroup) error
+	Close() error
+}
+
+type actionConfiguration struct {
+	policy              keepPolicy
+	logFn               func(format string, a ...any)
+	journal             *journal
+	quarantineDirectory string
+	dryRun              bool
+	relativeSymlinks    bool
+}
+
+type actionStatistics struct {
+	reclaimedSize int64
+	filesChanged  int
+	filesFailed   int
+	filesSkipped  int
+	groupsSkipped int
+}
+
+type noneAction struct{}
+
+// fileOperation describes how an action replaces a single extra copy, the
+// optional checkGroup and checkFile hooks can veto a whole group or a single
+// copy before anything changes. journalPaths returns the source and target
+// recorded in the journal, by default the kept file and the extra copy.
+type fileOperation struct {
+	run          func(keeper *commons.File, extra *commons.File) error
+	checkGroup   func(group *duplicateGroup, keeper int) error
+	checkFile    func(keeper *commons.File, extra *commons.File) error
+	journalPaths func(keeper *commons.File, extra *commons.File) (string, string, error)
+	verb         string
+	pastVerb     string
+}
+
+type fileAction struct {
+	operation     fileOperation
+	configuration actionConfiguration
+	stats         actionStatistics
+}
+
+func newKeepPolicy(name string, preferredDirectories []string) (keepPolicy, error) {
+	switch name {
+	case keepOldest:
+		return keepOldestFile, nil
+	case keepNewest:
+		return keepNewestFile, nil
+	case keepShortest:
+		return keepShortestPath, nil
+	case keepPreferred:
+		if len(preferredDirectories) == 0 {
+			return nil, fmt.Errorf("%w: keep policy %s needs at least one -prefer directory", os.ErrInvalid, name)
+		}
+
+		return getPreferredDirectoryPolicy(preferredDirectories), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported keep policy %s", os.ErrInvalid, name)
+	}
+}
+
+func keepOldestFile(files []commons.File) (int, error) {
+	if len(files) == 0 {
+		return -1, errNoKeeper
+	}
+
+	keeper := 0
+	for index := range files {
+		if files[index].ModTime.Before(files[keeper].ModTime) {
+			keeper = index
+		}
+	}
+
+	return keeper, nil
+}
+
+func keepNewestFile(files []commons.File) (int, error) {
+	if len(files) == 0 {
+		return -1, errNoKeeper
+	}
+
+	keeper := 0
+	for index := range files {
+		if files[index].ModTime.After(files[keeper].ModTime) {
+			keeper = index
+		}
+	}
+
+	return keeper, nil
+}
+
+func keepShortestPath(files []commons.File) (int, error) {
+	if len(files) == 0 {
+		return -1, errNoKeeper
+	}
+
+	keeper := 0
+	for index := range files {
+		if len(files[index].Name) < len(files[keeper].Name) {
+			keeper = index
+		}
+	}
+
+	return keeper, nil
+}
+
+func getPreferredDirectoryPolicy(preferredDirectories []string) keepPolicy {
+	return func(files []commons.File) (int, error) {
+		for _, directory := range preferredDirectories {
+			for index := range files {
+				if isInsideDirectory(files[index].Name, directory) {
+					return index, nil
+				}
+			}
+		}
+
+		return -1, errNoKeeper
+	}
+}
+
+func isInsideDirectory(fullPath string, directory string) bool {
+	cleanDirectory := filepath.Clean(directory)
+	cleanPath := filepath.Clean(fullPath)
+
+	if cleanDirectory == string(filepath.Separator) {
+		return true
+	}
+
+	return cleanPath == cleanDirectory || strings.HasPrefix(cleanPath, cleanDirectory+string(filepath.Separator))
+}
+
+func newGroupAction(name string, configuration actionConfiguration) (groupAction, error) {
+	switch name {
+	case noneActionName:
+		return &noneAction{}, nil
+	case deleteActionName:
+		return newFileAction(configuration, fileOperation{
+			run:          removeExtraCopy,
+			checkGroup:   nil,
+			checkFile:    nil,
+			journalPaths: getKeeperJournalPaths,
+			verb:         removeOperation,
+			pastVerb:     "removed",
+		}), nil
+	case hardlinkActionName:
+		return newFileAction(configuration, fileOperation{
+			run:          hardlinkExtraCopy,
+			checkGroup:   checkSingleDevice,
+			checkFile:    checkSameMode,
+			journalPaths: getKeeperJournalPaths,
+			verb:         hardlinkActionName,
+			pastVerb:     "hardlinked",
+		}), nil
+	case symlinkActionName:
+		return newFileAction(configuration, fileOperation{
+			run:          getSymlinkOperation(configuration.relativeSymlinks),
+			checkGroup:   nil,
+			checkFile:    nil,
+			journalPaths: getKeeperJournalPaths,
+			verb:         symlinkActionName,
+			pastVerb:     "symlinked",
+		}), nil
+	case reflinkActionName:
+		return newFileAction(configuration, fileOperation{
+			run:          reflinkExtraCopy,
+			checkGroup:   checkSingleDevice,
+			checkFile:    nil,
+			journalPaths: getKeeperJournalPaths,
+			verb:         reflinkActionName,
+			pastVerb:     "reflinked",
+		}), nil
+	case quarantineActionName:
+		if configuration.quarantineDirectory == "" {
+			return nil, fmt.Errorf("%w: quarantine action needs a -to directory", os.ErrInvalid)
+		}
+
+		return newFileAction(configuration, fileOperation{
+			run:          getQuarantineOperation(configuration.quarantineDirectory),
+			checkGroup:   nil,
+			checkFile:    nil,
+			journalPaths: getQuarantineJournalPaths(configuration.quarantineDirectory),
+			verb:         quarantineActionName,
+			pastVerb:     "quarantined",
+		}), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported action %s", os.ErrInvalid, name)
+	}
+}
+
+func newFileAction(configuration actionConfiguration, operation fileOperation) *fileAction {
+	return &fileAction{
+		operation:     operation,
+		configuration: configuration,
+		stats:         actionStatistics{reclaimedSize: 0, filesChanged: 0, filesFailed: 0, filesSkipped: 0, groupsSkipped: 0},
+	}
+}
+
+func (*noneAction) Apply(_ *duplicateGroup) error {
+	return nil
+}
+
+func (*noneAction) Close() error {
+	return nil
+}
+
+// selectKeeper applies the keep policy and makes sure the kept file is still
+// on disk as a regular file, so that removing the other members never
+// destroys the last copy of the group.
+func selectKeeper(group *duplicateGroup, policy keepPolicy) (int, os.FileInfo, error) {
+	if len(group.files) < 2 {
+		return -1, nil, fmt.Errorf("%w: group %d has less than two members", os.ErrInvalid, group.id)
+	}
+
+	keeper, err := policy(group.files)
+	if err != nil {
+		return -1, nil, fmt.Errorf("group %d: %w", group.id, err)
+	}
+
+	if keeper < 0 || keeper >= len(group.files) {
+		return -1, nil, fmt.Errorf("%w: group %d keeper index out of range", os.ErrInvalid, group.id)
+	}
+
+	keeperInfo, err := os.Lstat(group.files[keeper].Name)
+	if err != nil {
+		return -1, nil, fmt.Errorf("group %d: kept file is not available: %w", group.id, err)
+	}
+
+	if !keeperInfo.Mode().IsRegular() || keeperInfo.Size() != group.files[keeper].Size {
+		return -1, nil, fmt.Errorf("%w: group %d kept file changed since scan", os.ErrInvalid, group.id)
+	}
+
+	return keeper, keeperInfo, nil
+}
+
+// checkExtraCopy verifies that a member scheduled for removal is still the
+// file seen during the scan and is not the kept file reached via another path
+// (bind mounts, hard links).
+func checkExtraCopy(file *commons.File, keeperInfo os.FileInfo) error {
+	info, err := os.Lstat(file.Name)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if !info.Mode().IsRegular() || info.Size() != file.Size {
+		return fmt.Errorf("%w: %s changed since scan", os.ErrInvalid, file.Name)
+	}
+
+	if os.SameFile(info, keeperInfo) {
+		return fmt.Errorf("%w: %s is the kept file", os.ErrExist, file.Name)
+	}
+
+	return nil
+}
+
+func (action *fileAction) Apply(group *duplicateGroup) error {
+	keeper, keeperInfo, err := selectKeeper(group, action.configuration.policy)
+	if err == nil && action.operation.checkGroup != nil {
+		err = action.operation.checkGroup(group, keeper)
+	}
+
+	if err != nil {
+		action.stats.groupsSkipped++
+		action.configuration.logFn("skipping group %d: %v", group.id, err)
+		return nil
+	}
+
+	action.configuration.logFn("keeping: %s", group.files[keeper].Name)
+
+	for index := range group.files {
+		if index == keeper {
+			continue
+		}
+
+		// a copy only frees space once all its hardlinks are changed
+		changedPaths := 0
+		paths := append([]string{group.files[index].Name}, group.files[index].Links...)
+
+		for _, path := range paths {
+			extra := group.files[index]
+			extra.Name = path
+			extra.Links = nil
+
+			changed, err := action.applyToPath(&group.files[keeper], keeperInfo, &extra)
+			if err != nil {
+				return err
+			}
+
+			if changed {
+				changedPaths++
+			}
+		}
+
+		if changedPaths == len(paths) {
+			action.stats.reclaimedSize += group.files[index].Size
+		}
+	}
+
+	return nil
+}
+
+// applyToPath changes a single path of an extra copy and tells whether it was
+// changed, only journal failures are returned.
+func (action *fileAction) applyToPath(keeper *commons.File, keeperInfo os.FileInfo, extra *commons.File) (bool, error) {
+	err := checkExtraCopy(extra, keeperInfo)
+	if err == nil && action.operation.checkFile != nil {
+		err = action.operation.checkFile(keeper, extra)
+	}
+
+	if err != nil {
+		action.stats.filesSkipped++
+		action.configuration.logFn("not changing %s: %v", extra.Name, err)
+
+		return false, nil
+	}
+
+	if action.configuration.dryRun {
+		action.configuration.logFn("would %s: %s", action.operation.verb, extra.Name)
+	} else {
+		entry, err := action.beginOperation(keeper, extra)
+		if err != nil {
+			return false, err
+		}
+
+		operationErr := action.operation.run(keeper, extra)
+
+		err = action.configuration.journal.Commit(entry, operationErr)
+		if err != nil {
+			return false, fmt.Errorf("%w", err)
+		}
+
+		if operationErr != nil {
+			action.stats.filesFailed++
+			action.configuration.logFn("failed to %s %s: %v", action.operation.verb, extra.Name, operationErr)
+
+			return false, nil
+		}
+
+		action.configuration.logFn("%s: %s", action.operation.pastVerb, extra.Name)
+	}
+
+	action.stats.filesChanged++
+
+	return true, nil
+}
+
+// beginOperation records the change as pending before it is made, so that
+// an interrupted run never leaves an unrecorded change behind.
+func (action *fileAction) beginOperation(keeper *commons.File, extra *commons.File) (journalEntry, error) {
+	if action.configuration.journal == nil {
+		return journalEntry{}, nil
+	}
+
+	source, target, err := action.operation.journalPaths(keeper, extra)
+	if err != nil {
+		return journalEntry{}, err
+	}
+
+	source, target, err = absoluteJournalPaths(source, target)
+	if err != nil {
+		return journalEntry{}, err
+	}
+
+	entry, err := newJournalEntry(action.operation.verb, source, target, extra.Name)
+	if err != nil {
+		return journalEntry{}, err
+	}
+
+	entry, err = action.configuration.journal.Begin(entry)
+	if err != nil {
+		return journalEntry{}, fmt.Errorf("%w", err)
+	}
+
+	return entry, nil
+}
+
+func getKeeperJournalPaths(keeper *commons.File, extra *commons.File) (string, string, error) {
+	return keeper.Name, extra.Name, nil
+}
+
+func (action *fileAction) Close() error {
+	return action.stats.log(action.configuration, action.operation.pastVerb)
+}
+
+func removeExtraCopy(_ *commons.File, extra *commons.File) error {
+	err := os.Remove(extra.Name)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func (stats *actionStatistics) log(configuration actionConfiguration, verb string) error {
+	formattedSize, err := commons.FormatFileSize(stats.reclaimedSize)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if configuration.dryRun {
+		verb = "would be " + verb
+	}
+
+	configuration.logFn(
+		"%d files %s, %d %s reclaimed, %d files failed, %d files skipped, %d groups skipped",
+		stats.filesChanged, verb, formattedSize.Value, *formattedSize.Unit,
+		stats.filesFailed, stats.filesSkipped, stats.groupsSkipped,
+	)
+
+	return nil
+}
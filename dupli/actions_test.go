@@ -0,0 +1,207 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"archive-tools-monorepo/commons"
+	datastructures "archive-tools-monorepo/dataStructures"
+)
+
+func newTestGroup(t *testing.T, baseDir string, names ...string) *duplicateGroup {
+	t.Helper()
+
+	registry := datastructures.Flyweight[string]{}
+	hash, err := registry.Instance("hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := newDuplicateGroup()
+	group.id = 1
+
+	for index, name := range names {
+		fullPath := filepath.Join(baseDir, name)
+		modTime := time.Date(2020, 1, index+1, 0, 0, 0, 0, time.UTC)
+
+		err = os.MkdirAll(filepath.Dir(fullPath), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(fullPath, []byte("content"), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chtimes(fullPath, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		group.files = append(group.files, commons.File{Name: fullPath, Size: 7, Hash: hash, ModTime: modTime})
+	}
+
+	group.hash = "hash"
+	group.size = 7
+
+	return &group
+}
+
+func newTestConfiguration(policy keepPolicy, dryRun bool) actionConfiguration {
+	return actionConfiguration{
+		policy:              policy,
+		logFn:               func(string, ...any) {},
+		journal:             nil,
+		quarantineDirectory: "",
+		dryRun:              dryRun,
+		relativeSymlinks:    false,
+	}
+}
+
+func TestKeepPolicy_SelectsExpectedFile(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/long/name", "b/x", "c/middle")
+
+	testCases := []struct {
+		name     string
+		prefer   []string
+		expected int
+	}{
+		{name: keepOldest, prefer: nil, expected: 0},
+		{name: keepNewest, prefer: nil, expected: 2},
+		{name: keepShortest, prefer: nil, expected: 1},
+		{name: keepPreferred, prefer: []string{"/nowhere", filepath.Dir(group.files[2].Name)}, expected: 2},
+	}
+
+	for _, testCase := range testCases {
+		policy, err := newKeepPolicy(testCase.name, testCase.prefer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keeper, err := policy(group.files)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if keeper != testCase.expected {
+			t.Errorf("policy %s: expected %d, got %d", testCase.name, testCase.expected, keeper)
+		}
+	}
+}
+
+func TestKeepPolicy_PreferWithoutMatch_Error(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+
+	policy, err := newKeepPolicy(keepPreferred, []string{"/nowhere"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = policy(group.files)
+	if err == nil {
+		t.Error("expected error when no file is inside a preferred directory")
+	}
+}
+
+func TestDeleteAction_DryRun_KeepsEveryFile(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file", "c/file")
+
+	action, err := newGroupAction(deleteActionName, newTestConfiguration(keepOldestFile, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range group.files {
+		_, err = os.Stat(group.files[index].Name)
+		if err != nil {
+			t.Errorf("dry run removed %s", group.files[index].Name)
+		}
+	}
+}
+
+func TestDeleteAction_RemovesAllButKeeper(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file", "c/file")
+
+	action, err := newGroupAction(deleteActionName, newTestConfiguration(keepNewestFile, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range group.files {
+		_, err = os.Stat(group.files[index].Name)
+		if index == 2 && err != nil {
+			t.Errorf("kept file %s was removed", group.files[index].Name)
+		}
+
+		if index != 2 && err == nil {
+			t.Errorf("duplicate %s was not removed", group.files[index].Name)
+		}
+	}
+}
+
+func TestDeleteAction_MissingKeeper_RemovesNothing(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+
+	err := os.Remove(group.files[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	action, err := newGroupAction(deleteActionName, newTestConfiguration(keepOldestFile, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(group.files[1].Name)
+	if err != nil {
+		t.Error("last copy of the group was removed")
+	}
+}
+
+func TestDeleteAction_SameFileAsKeeper_NotRemoved(t *testing.T) {
+	baseDir := t.TempDir()
+	group := newTestGroup(t, baseDir, "a/file")
+
+	linkPath := filepath.Join(baseDir, "a/link")
+	err := os.Link(group.files[0].Name, linkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group.files = append(group.files, commons.File{
+		Name: linkPath, Size: 7, Hash: group.files[0].Hash, ModTime: time.Now(),
+	})
+
+	action, err := newGroupAction(deleteActionName, newTestConfiguration(keepOldestFile, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(linkPath)
+	if err != nil {
+		t.Error("path sharing the kept file was removed")
+	}
+}
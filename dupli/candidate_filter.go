@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"archive-tools-monorepo/commons"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+	year = 365 * day
+)
+
+// ageUnits extends time.ParseDuration with days, weeks and years.
+var ageUnits = map[string]time.Duration{"d": day, "w": week, "y": year}
+
+// candidateFilter drops files by size, modification time and extension
+// before they are hashed. Zero values leave a bound open, an extension
+// listed with a leading ! is denied.
+type candidateFilter struct {
+	newerThan         time.Time
+	olderThan         time.Time
+	allowedExtensions map[string]struct{}
+	deniedExtensions  map[string]struct{}
+	minSize           int64
+	maxSize           int64
+}
+
+// parseAge reads a date (2006-01-02 or RFC 3339) or an age such as 90d,
+// 1y or 36h counted back from now.
+func parseAge(text string, now time.Time) (time.Time, error) {
+	date, err := time.ParseInLocation(time.DateOnly, text, time.Local)
+	if err == nil {
+		return date, nil
+	}
+
+	date, err = time.Parse(time.RFC3339, text)
+	if err == nil {
+		return date, nil
+	}
+
+	if text != "" {
+		unit, found := ageUnits[text[len(text)-1:]]
+		if found {
+			count, err := strconv.ParseFloat(text[:len(text)-1], 64)
+			if err == nil && count >= 0 {
+				return now.Add(-time.Duration(count * float64(unit))), nil
+			}
+		}
+	}
+
+	duration, err := time.ParseDuration(text)
+	if err != nil || duration < 0 {
+		return time.Time{}, fmt.Errorf("%w: %s is neither a date nor an age", os.ErrInvalid, text)
+	}
+
+	return now.Add(-duration), nil
+}
+
+func normalizeExtension(extension string) string {
+	return strings.ToLower(strings.TrimPrefix(extension, "."))
+}
+
+func newCandidateFilter(options *filterOptions, now time.Time) (*candidateFilter, error) {
+	var err error
+
+	candidates := &candidateFilter{
+		newerThan:         time.Time{},
+		olderThan:         time.Time{},
+		allowedExtensions: make(map[string]struct{}),
+		deniedExtensions:  make(map[string]struct{}),
+		minSize:           0,
+		maxSize:           0,
+	}
+
+	if options.minSize != "" {
+		candidates.minSize, err = commons.ParseFileSize(options.minSize)
+		if err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+	}
+
+	if options.maxSize != "" {
+		candidates.maxSize, err = commons.ParseFileSize(options.maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+	}
+
+	if candidates.maxSize > 0 && candidates.minSize > candidates.maxSize {
+		return nil, fmt.Errorf("%w: minimum size is above maximum size", os.ErrInvalid)
+	}
+
+	if options.newerThan != "" {
+		candidates.newerThan, err = parseAge(options.newerThan, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if options.olderThan != "" {
+		candidates.olderThan, err = parseAge(options.olderThan, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, extension := range filter(strings.Split(options.extensions, ","), "") {
+		if denied, found := strings.CutPrefix(extension, "!"); found {
+			candidates.deniedExtensions[normalizeExtension(denied)] = struct{}{}
+		} else {
+			candidates.allowedExtensions[normalizeExtension(extension)] = struct{}{}
+		}
+	}
+
+	return candidates, nil
+}
+
+func (candidates *candidateFilter) allows(name string, size int64, modTime time.Time) bool {
+	if size < candidates.minSize || candidates.maxSize > 0 && size > candidates.maxSize {
+		return false
+	}
+
+	if !candidates.newerThan.IsZero() && modTime.Before(candidates.newerThan) {
+		return false
+	}
+
+	if !candidates.olderThan.IsZero() && !modTime.Before(candidates.olderThan) {
+		return false
+	}
+
+	extension := normalizeExtension(filepath.Ext(name))
+
+	if _, denied := candidates.deniedExtensions[extension]; denied {
+		return false
+	}
+
+	if len(candidates.allowedExtensions) == 0 {
+		return true
+	}
+
+	_, allowed := candidates.allowedExtensions[extension]
+
+	return allowed
+}
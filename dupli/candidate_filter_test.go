@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"archive-tools-monorepo/commons"
+)
+
+func TestParseAge_DatesAndAges(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	expected := map[string]time.Time{
+		"36h":                  now.Add(-36 * time.Hour),
+		"30d":                  now.Add(-30 * day),
+		"2w":                   now.Add(-2 * week),
+		"1y":                   now.Add(-year),
+		"2023-01-02T03:04:05Z": time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		"2023-01-02":           time.Date(2023, 1, 2, 0, 0, 0, 0, time.Local),
+	}
+
+	for text, date := range expected {
+		parsed, err := parseAge(text, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", text, err)
+		}
+
+		if !parsed.Equal(date) {
+			t.Errorf("%s: expected %v, got %v", text, date, parsed)
+		}
+	}
+
+	for _, text := range []string{"", "yesterday", "-3d", "2023-13-45"} {
+		_, err := parseAge(text, now)
+		if !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("%s: expected invalid argument error, got %v", text, err)
+		}
+	}
+}
+
+func TestCandidateFilter_Allows(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	options := defaultFilterOptions()
+	options.minSize = "100M"
+	options.maxSize = "2GiB"
+	options.newerThan = "1y"
+	options.extensions = "MP4,.mkv,!part"
+
+	candidates, err := newCandidateFilter(&options, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recent := now.Add(-30 * day)
+	cases := []struct {
+		name     string
+		modTime  time.Time
+		size     int64
+		expected bool
+	}{
+		{"/v/movie.mp4", recent, 500_000_000, true},
+		{"/v/movie.MKV", recent, 100_000_000, true},
+		{"/v/small.mp4", recent, 99_999_999, false},
+		{"/v/huge.mp4", recent, 2<<30 + 1, false},
+		{"/v/old.mp4", now.Add(-2 * year), 500_000_000, false},
+		{"/v/movie.avi", recent, 500_000_000, false},
+		{"/v/movie.part", recent, 500_000_000, false},
+	}
+
+	for _, current := range cases {
+		if candidates.allows(current.name, current.size, current.modTime) != current.expected {
+			t.Errorf("%s: expected allowed %v", current.name, current.expected)
+		}
+	}
+}
+
+func TestCandidateFilter_InvalidOptions_Error(t *testing.T) {
+	invalid := []func(*filterOptions){
+		func(options *filterOptions) { options.minSize = "ten" },
+		func(options *filterOptions) { options.minSize, options.maxSize = "2G", "1G" },
+		func(options *filterOptions) { options.olderThan = "soon" },
+	}
+
+	for index, change := range invalid {
+		options := defaultFilterOptions()
+		change(&options)
+
+		_, err := newCandidateFilter(&options, time.Now())
+		if !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("case %d: expected invalid argument error, got %v", index, err)
+		}
+	}
+}
+
+func TestDirWalker_CandidateFilter_SkipsBeforeCallback(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{
+		"large.mp4": "0123456789",
+		"small.mp4": "01",
+		"large.txt": "0123456789",
+		"old.mp4":   "0123456789",
+	})
+
+	old := time.Now().Add(-2 * year)
+	if err := os.Chtimes(filepath.Join(baseDir, "old.mp4"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	options := defaultFilterOptions()
+	options.minSize = "5"
+	options.newerThan = "1y"
+	options.extensions = "mp4"
+
+	candidates, err := newCandidateFilter(&options, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walker := NewWalker(false)
+	walker.SetEntryPoint(baseDir)
+	walker.SetDirectoryFilter(func(_ string) bool {
+		return true
+	})
+	walker.SetCandidateFilter(candidates)
+
+	walked := make([]string, 0)
+	walker.SetFileCallback(func(info FilesystemObject) {
+		walked = append(walked, filepath.Base(info.path))
+	})
+	walker.SetDirectoryCallback(func() {})
+	walker.Walk()
+
+	if len(walked) != 1 || walked[0] != "large.mp4" || walker.stats.fileSeen != 1 {
+		t.Errorf("expected only large.mp4, got %v", walked)
+	}
+}
+
+func TestFileFilters_Allows_SnapshotCandidates(t *testing.T) {
+	options := defaultFilterOptions()
+	options.maxSize = "1k"
+	options.extensions = "!tmp"
+
+	filters, err := options.build(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]int64{"/data/a.txt": 10, "/data/b.txt": 2000, "/data/c.tmp": 10}
+	expected := map[string]bool{"/data/a.txt": true, "/data/b.txt": false, "/data/c.tmp": false}
+
+	for name, size := range files {
+		file := commons.File{Name: name, Size: size}
+		if filters.allows(&file) != expected[name] {
+			t.Errorf("%s: expected allowed %v", name, expected[name])
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"archive-tools-monorepo/commons"
+	datastructures "archive-tools-monorepo/dataStructures"
+)
+
+type contentKey struct {
+	hash *string
+	size int64
+}
+
+// contentLocation is one path of a content, linked tells the path is a
+// hardlink of a file already counted in the same snapshot.
+type contentLocation struct {
+	Path     string `json:"path"`
+	Snapshot int    `json:"snapshot"`
+	linked   bool
+}
+
+// snapshotContent gathers every copy of one content across the snapshots,
+// snapshotsCount is the number of distinct snapshots holding it.
+type snapshotContent struct {
+	hash           datastructures.Constant[string]
+	locations      []contentLocation
+	size           int64
+	snapshotsCount int
+	lastSnapshot   int
+}
+
+// snapshotOverlap counts the files of a snapshot whose content also exists
+// in the other snapshot named here.
+type snapshotOverlap struct {
+	Snapshot string `json:"snapshot"`
+	Files    int    `json:"files"`
+	Size     int64  `json:"size"`
+}
+
+type snapshotStatistics struct {
+	Snapshot    string            `json:"snapshot"`
+	Roots       []string          `json:"roots"`
+	Overlap     []snapshotOverlap `json:"overlap"`
+	Files       int               `json:"files"`
+	Size        int64             `json:"size"`
+	SharedFiles int               `json:"shared_files"`
+	SharedSize  int64             `json:"shared_size"`
+	UniqueFiles int               `json:"unique_files"`
+	UniqueSize  int64             `json:"unique_size"`
+	Redundant   bool              `json:"redundant"`
+}
+
+type jsonContent struct {
+	Hash      string            `json:"hash"`
+	Locations []contentLocation `json:"locations"`
+	Size      int64             `json:"size"`
+}
+
+type jsonComparison struct {
+	Snapshots []snapshotStatistics `json:"snapshots"`
+	Shared    []jsonContent        `json:"shared,omitempty"`
+	Unique    []jsonContent        `json:"unique,omitempty"`
+}
+
+// snapshotComparison indexes the files of several snapshots by content, the
+// hashes of every snapshot are interned in the same registry so contents are
+// told apart by pointer. identities holds the device and inode of the files
+// of every snapshot, so hardlinks are only counted once.
+type snapshotComparison struct {
+	contents      map[contentKey]*snapshotContent
+	identities    []map[fileIdentity]struct{}
+	snapshotPaths []string
+	headers       []snapshotHeader
+}
+
+func compareSnapshots(snapshotPaths []string, registry *datastructures.Flyweight[string]) (*snapshotComparison, error) {
+	if len(snapshotPaths) < 2 {
+		return nil, fmt.Errorf("%w: at least two snapshots are needed", os.ErrInvalid)
+	}
+
+	comparison := &snapshotComparison{
+		contents:      make(map[contentKey]*snapshotContent),
+		identities:    make([]map[fileIdentity]struct{}, len(snapshotPaths)),
+		snapshotPaths: snapshotPaths,
+		headers:       make([]snapshotHeader, 0, len(snapshotPaths)),
+	}
+
+	for index, snapshotPath := range snapshotPaths {
+		comparison.identities[index] = make(map[fileIdentity]struct{})
+
+		header, err := loadSnapshot(snapshotPath, registry, func(file commons.File) error {
+			comparison.add(index, &file)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if index > 0 && header.Scan.HashAlgorithm != comparison.headers[0].Scan.HashAlgorithm {
+			return nil, fmt.Errorf(
+				"%w: %s uses %s hashes while %s uses %s", os.ErrInvalid, snapshotPath, header.Scan.HashAlgorithm,
+				snapshotPaths[0], comparison.headers[0].Scan.HashAlgorithm,
+			)
+		}
+
+		comparison.headers = append(comparison.headers, header)
+	}
+
+	return comparison, nil
+}
+
+func (comparison *snapshotComparison) add(snapshot int, file *commons.File) {
+	key := contentKey{hash: file.Hash.Ptr(), size: file.Size}
+
+	content, found := comparison.contents[key]
+	if !found {
+		content = &snapshotContent{
+			hash:           file.Hash,
+			locations:      make([]contentLocation, 0, 1),
+			size:           file.Size,
+			snapshotsCount: 0,
+			lastSnapshot:   -1,
+		}
+		comparison.contents[key] = content
+	}
+
+	if content.lastSnapshot != snapshot {
+		content.snapshotsCount++
+		content.lastSnapshot = snapshot
+	}
+
+	linked := false
+
+	if file.Inode != 0 {
+		identity := fileIdentity{device: file.Device, inode: file.Inode}
+
+		_, linked = comparison.identities[snapshot][identity]
+		comparison.identities[snapshot][identity] = struct{}{}
+	}
+
+	content.locations = append(content.locations, contentLocation{Path: file.Name, Snapshot: snapshot, linked: linked})
+}
+
+// sortedContents returns the contents ordered by hash and size, so that
+// reports do not depend on map iteration order.
+func (comparison *snapshotComparison) sortedContents() []*snapshotContent {
+	contents := make([]*snapshotContent, 0, len(comparison.contents))
+
+	for _, content := range comparison.contents {
+		contents = append(contents, content)
+	}
+
+	slices.SortFunc(contents, func(a *snapshotContent, b *snapshotContent) int {
+		if order := strings.Compare(a.hash.Value(), b.hash.Value()); order != 0 {
+			return order
+		}
+
+		return cmp.Compare(a.size, b.size)
+	})
+
+	return contents
+}
+
+// holders returns the snapshots holding content, locations are added one
+// snapshot after the other so they are already grouped by snapshot.
+func (content *snapshotContent) holders() []int {
+	holders := make([]int, 0, content.snapshotsCount)
+
+	for _, location := range content.locations {
+		if len(holders) == 0 || holders[len(holders)-1] != location.Snapshot {
+			holders = append(holders, location.Snapshot)
+		}
+	}
+
+	return holders
+}
+
+// statistics counts for every snapshot the files whose content also exists
+// in another snapshot, overall and for every other snapshot. Hardlinks are
+// counted once, a redundant snapshot has no unique file and can be wiped.
+func (comparison *snapshotComparison) statistics() []snapshotStatistics {
+	stats := make([]snapshotStatistics, len(comparison.snapshotPaths))
+
+	for index := range stats {
+		stats[index].Snapshot = comparison.snapshotPaths[index]
+		stats[index].Roots = comparison.headers[index].Scan.Roots
+		stats[index].Overlap = make([]snapshotOverlap, 0, len(stats)-1)
+
+		for other, otherPath := range comparison.snapshotPaths {
+			if other != index {
+				stats[index].Overlap = append(stats[index].Overlap, snapshotOverlap{Snapshot: otherPath, Files: 0, Size: 0})
+			}
+		}
+	}
+
+	for _, content := range comparison.contents {
+		holders := content.holders()
+
+		for _, location := range content.locations {
+			if location.linked {
+				continue
+			}
+
+			current := &stats[location.Snapshot]
+			current.Files++
+			current.Size += content.size
+
+			if content.snapshotsCount > 1 {
+				current.SharedFiles++
+				current.SharedSize += content.size
+			} else {
+				current.UniqueFiles++
+				current.UniqueSize += content.size
+			}
+
+			for _, holder := range holders {
+				if holder == location.Snapshot {
+					continue
+				}
+
+				// the overlap list skips the snapshot itself
+				position := holder
+				if holder > location.Snapshot {
+					position--
+				}
+
+				overlap := &current.Overlap[position]
+				overlap.Files++
+				overlap.Size += content.size
+			}
+		}
+	}
+
+	for index := range stats {
+		stats[index].Redundant = stats[index].UniqueFiles == 0
+	}
+
+	return stats
+}
+
+func (stats *snapshotStatistics) coverage() float64 {
+	if stats.Size == 0 {
+		return 100.0
+	}
+
+	return float64(stats.SharedSize) / float64(stats.Size) * 100.0
+}
+
+func (content *snapshotContent) toJSON() jsonContent {
+	return jsonContent{Hash: content.hash.Value(), Locations: content.locations, Size: content.size}
+}
+
+func (comparison *snapshotComparison) writeJSON(writer io.Writer, summaryOnly bool) error {
+	report := jsonComparison{
+		Snapshots: comparison.statistics(),
+		Shared:    make([]jsonContent, 0),
+		Unique:    make([]jsonContent, 0),
+	}
+
+	if !summaryOnly {
+		for _, content := range comparison.sortedContents() {
+			if content.snapshotsCount > 1 {
+				report.Shared = append(report.Shared, content.toJSON())
+			} else {
+				report.Unique = append(report.Unique, content.toJSON())
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(report)
+	if err != nil {
+		return fmt.Errorf("error while writing json comparison: %w", err)
+	}
+
+	return nil
+}
+
+func (comparison *snapshotComparison) printLocations(content *snapshotContent) {
+	for _, location := range content.locations {
+		ui.Println("  [%s] %s", comparison.snapshotPaths[location.Snapshot], location.Path)
+	}
+}
+
+func (comparison *snapshotComparison) writeText(summaryOnly bool) error {
+	contents := comparison.sortedContents()
+
+	if !summaryOnly {
+		ui.Println("Present in several snapshots:")
+
+		for _, content := range contents {
+			if content.snapshotsCount > 1 {
+				ui.Println("%s %d bytes", content.hash.Value(), content.size)
+				comparison.printLocations(content)
+			}
+		}
+
+		ui.Println("")
+		ui.Println("Unique to one snapshot:")
+
+		for _, content := range contents {
+			if content.snapshotsCount == 1 {
+				ui.Println("%s %d bytes", content.hash.Value(), content.size)
+				comparison.printLocations(content)
+			}
+		}
+
+		ui.Println("")
+	}
+
+	for _, stats := range comparison.statistics() {
+		formattedSize, err := commons.FormatFileSize(stats.Size)
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		formattedUnique, err := commons.FormatFileSize(stats.UniqueSize)
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		verdict := "keep it"
+		if stats.Redundant {
+			verdict = "everything exists elsewhere"
+		}
+
+		ui.Println(
+			"%s: %d files, %d %s, %d files also elsewhere, %d unique files (%d %s), %.1f %% covered, %s",
+			stats.Snapshot, stats.Files, formattedSize.Value, *formattedSize.Unit, stats.SharedFiles,
+			stats.UniqueFiles, formattedUnique.Value, *formattedUnique.Unit, stats.coverage(), verdict,
+		)
+
+		for _, overlap := range stats.Overlap {
+			formattedOverlap, err := commons.FormatFileSize(overlap.Size)
+			if err != nil {
+				return fmt.Errorf("%w", err)
+			}
+
+			ui.Println(
+				"  %d files (%d %s) also in %s",
+				overlap.Files, formattedOverlap.Value, *formattedOverlap.Unit, overlap.Snapshot,
+			)
+		}
+	}
+
+	return nil
+}
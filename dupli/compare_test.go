@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"archive-tools-monorepo/commons"
+	datastructures "archive-tools-monorepo/dataStructures"
+)
+
+func writeTestSnapshot(t *testing.T, snapshotPath string, algorithm string, files map[string]string) {
+	t.Helper()
+
+	registry := datastructures.Flyweight[string]{}
+
+	snapshot, err := createSnapshot(snapshotPath, newScanMetadata([]string{"/"}, algorithm, &dirwalkerStatistics{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, hash := range files {
+		hashPointer, err := registry.Instance(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = snapshot.Write(&commons.File{Name: name, Size: int64(len(hash)), Hash: hashPointer})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = snapshot.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompare_Statistics_SharedAndUniqueFiles(t *testing.T) {
+	baseDir := t.TempDir()
+	first := filepath.Join(baseDir, "first.db")
+	second := filepath.Join(baseDir, "second.db")
+
+	writeTestSnapshot(t, first, commons.SHA1Hash, map[string]string{"/a/one": "aaaa", "/a/two": "bbbbbb"})
+	writeTestSnapshot(t, second, commons.SHA1Hash, map[string]string{"/b/one": "aaaa", "/b/copy": "aaaa"})
+
+	comparison, err := compareSnapshots([]string{first, second}, &datastructures.Flyweight[string]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(comparison.contents) != 2 {
+		t.Errorf("expected 2 contents interned across snapshots, got %d", len(comparison.contents))
+	}
+
+	stats := comparison.statistics()
+	expected := []snapshotStatistics{
+		{
+			Snapshot: first, Overlap: []snapshotOverlap{{Snapshot: second, Files: 1, Size: 4}},
+			Files: 2, Size: 10, SharedFiles: 1, SharedSize: 4, UniqueFiles: 1, UniqueSize: 6, Redundant: false,
+		},
+		{
+			Snapshot: second, Overlap: []snapshotOverlap{{Snapshot: first, Files: 2, Size: 8}},
+			Files: 2, Size: 8, SharedFiles: 2, SharedSize: 8, UniqueFiles: 0, UniqueSize: 0, Redundant: true,
+		},
+	}
+
+	for index := range expected {
+		expected[index].Roots = stats[index].Roots
+		if !reflect.DeepEqual(stats[index], expected[index]) {
+			t.Errorf("snapshot %d: expected %+v, got %+v", index, expected[index], stats[index])
+		}
+	}
+}
+
+func TestCompare_Statistics_OverlapPerPairAndHardlinksCountedOnce(t *testing.T) {
+	baseDir := t.TempDir()
+	paths := []string{
+		filepath.Join(baseDir, "first.db"), filepath.Join(baseDir, "second.db"), filepath.Join(baseDir, "third.db"),
+	}
+	registry := datastructures.Flyweight[string]{}
+
+	snapshotFiles := [][]commons.File{
+		{
+			{Name: "/a/one", Size: 4, Device: 1, Inode: 10},
+			{Name: "/a/link", Size: 4, Device: 1, Inode: 10},
+			{Name: "/a/two", Size: 6, Device: 1, Inode: 11},
+		},
+		{{Name: "/b/one", Size: 4, Device: 2, Inode: 10}},
+		{{Name: "/c/two", Size: 6, Device: 3, Inode: 20}, {Name: "/c/one", Size: 4, Device: 3, Inode: 21}},
+	}
+	hashes := map[int64]string{4: "aaaa", 6: "bbbbbb"}
+
+	for index, files := range snapshotFiles {
+		metadata := newScanMetadata([]string{"/"}, commons.SHA1Hash, &dirwalkerStatistics{})
+
+		snapshot, err := createSnapshot(paths[index], metadata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, file := range files {
+			file.Hash, err = registry.Instance(hashes[file.Size])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = snapshot.Write(&file)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = snapshot.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	comparison, err := compareSnapshots(paths, &registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := comparison.statistics()
+
+	if stats[0].Files != 2 || stats[0].Size != 10 {
+		t.Errorf("expected the hardlink to be counted once, got %d files of %d bytes", stats[0].Files, stats[0].Size)
+	}
+
+	expected := [][]snapshotOverlap{
+		{{Snapshot: paths[1], Files: 1, Size: 4}, {Snapshot: paths[2], Files: 2, Size: 10}},
+		{{Snapshot: paths[0], Files: 1, Size: 4}, {Snapshot: paths[2], Files: 1, Size: 4}},
+		{{Snapshot: paths[0], Files: 2, Size: 10}, {Snapshot: paths[1], Files: 1, Size: 4}},
+	}
+
+	for index := range expected {
+		if !reflect.DeepEqual(stats[index].Overlap, expected[index]) {
+			t.Errorf("snapshot %d: expected overlap %+v, got %+v", index, expected[index], stats[index].Overlap)
+		}
+	}
+}
+
+func TestCompare_CompareSnapshots_DifferentAlgorithms(t *testing.T) {
+	baseDir := t.TempDir()
+	first := filepath.Join(baseDir, "first.db")
+	second := filepath.Join(baseDir, "second.db")
+
+	writeTestSnapshot(t, first, commons.SHA1Hash, map[string]string{"/a/one": "aaaa"})
+	writeTestSnapshot(t, second, commons.XXH64Hash, map[string]string{"/b/one": "aaaa"})
+
+	_, err := compareSnapshots([]string{first, second}, &datastructures.Flyweight[string]{})
+	if !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("expected invalid argument error, got %v", err)
+	}
+}
@@ -2,146 +2,647 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
+	"slices"
+	"sync"
 
 	"archive-tools-monorepo/commons"
 	datastructures "archive-tools-monorepo/dataStructures"
 )
 
+const (
+	defaultWalkerReaders = 8
+	breadthFirstOrder    = "bfs"
+	depthFirstOrder      = "dfs"
+	unlimitedDepth       = -1
+)
+
+// directoryContainer holds the directories waiting to be read, a queue walks
+// the tree breadth first and a stack depth first. Depth first only holds the
+// subdirectories of the directories along the current path instead of whole
+// levels of the tree.
+type directoryContainer interface {
+	Push(directory walkerDirectory)
+	Pop() (walkerDirectory, error)
+	Empty() bool
+}
+
 type dirWalkerConfiguration struct {
 	filterDirectory   func(string) bool
+	pathFilter        *pathFilter
+	candidates        *candidateFilter
 	fileCallback      func(FilesystemObject)
 	directoryCallback func()
+	skippedDevices    map[uint64]string
+	readers           int
+	maxDepth          int
 	skipEmpty         bool
+	followSymlinks    bool
+	oneFilesystem     bool
+}
+
+// walkerDirectory is a directory waiting to be read, the root it was reached
+// from, the device of this root, its depth below it and the rules of the
+// ignore files found above it. device is only known once the directory is
+// read, linked tells it was reached through a followed symbolic link.
+type walkerDirectory struct {
+	ignore       *ignoreRules
+	path         string
+	root         string
+	rootDevice   uint64
+	parentDevice uint64
+	device       uint64
+	depth        int
+	isRoot       bool
+	linked       bool
 }
 
+type directoryIdentity struct {
+	device uint64
+	inode  uint64
+}
+
+// walkerEvent is sent by the readers to the dispatcher, either a file to hand
+// to the file callback or the end of a directory.
+type walkerEvent struct {
+	file          FilesystemObject
+	directoryDone bool
+}
+
+// dirWalkerState remembers by device and inode only the directories a tree
+// can be reached again from: roots, followed link targets and mount points,
+// so a tree reachable from several roots (nested roots, bind mounts) is read
+// once and memory doesn't grow with the number of directories. trees holds
+// the resolved paths of the roots and followed link targets, links into them
+// are not followed. pending counts the directories queued or being read, the
+// walk is over when it drops to zero. Everything is guarded by mutex.
 type dirWalkerState struct {
-	currentDirectory string
-	currentFile      string
-	directoriesQueue datastructures.Queue[string]
+	directories        directoryContainer
+	visitedDirectories map[directoryIdentity]struct{}
+	trees              []string
+	mutex              *sync.Mutex
+	directoryAvailable *sync.Cond
+	pending            int
 }
 
 type dirwalkerStatistics struct {
-	sizeProcessed   int64
-	fileSeen        int
-	directoriesSeen int
+	sizeProcessed          int64
+	fileSeen               int
+	directoriesSeen        int
+	danglingLinks          []string
+	ignoreFileErrors       []string
+	overlappingDirectories int
+	skippedMounts          int
+	linkedPaths            int
 }
 
+// DirWalker lists directories with a bounded number of concurrent readers,
+// callbacks are always called from a single goroutine.
 type DirWalker struct {
 	configuration dirWalkerConfiguration
 	state         dirWalkerState
 	stats         dirwalkerStatistics
 }
 
+func newDirectoryContainer(order string) (directoryContainer, error) {
+	switch order {
+	case breadthFirstOrder:
+		queue := &datastructures.Queue[walkerDirectory]{}
+		queue.Init()
+
+		return queue, nil
+	case depthFirstOrder:
+		return &datastructures.Stack[walkerDirectory]{}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported traversal order %s", os.ErrInvalid, order)
+	}
+}
+
 func NewWalker(skipEmpty bool) *DirWalker {
-	newQueue := datastructures.Queue[string]{}
-	newQueue.Init()
+	container, err := newDirectoryContainer(breadthFirstOrder)
+	if err != nil {
+		panic(err)
+	}
+
+	mutex := &sync.Mutex{}
 
 	walker := DirWalker{
 		stats: dirwalkerStatistics{
-			fileSeen:        0,
-			directoriesSeen: 0,
-			sizeProcessed:   0,
+			fileSeen:               0,
+			directoriesSeen:        0,
+			sizeProcessed:          0,
+			danglingLinks:          make([]string, 0),
+			ignoreFileErrors:       make([]string, 0),
+			overlappingDirectories: 0,
+			skippedMounts:          0,
+			linkedPaths:            0,
 		},
 		configuration: dirWalkerConfiguration{
 			skipEmpty:         skipEmpty,
+			followSymlinks:    false,
+			oneFilesystem:     false,
+			skippedDevices:    nil,
+			readers:           defaultWalkerReaders,
+			maxDepth:          unlimitedDepth,
 			directoryCallback: nil,
 			filterDirectory:   nil,
+			pathFilter:        nil,
+			candidates:        nil,
 			fileCallback:      nil,
 		},
 		state: dirWalkerState{
-			directoriesQueue: newQueue,
-			currentDirectory: "",
-			currentFile:      "",
+			directories:        container,
+			visitedDirectories: make(map[directoryIdentity]struct{}),
+			trees:              make([]string, 0),
+			mutex:              mutex,
+			directoryAvailable: sync.NewCond(mutex),
+			pending:            0,
 		},
 	}
 
 	return &walker
 }
 
+// SetEntryPoint adds a root to walk, files found below it are tagged with the
+// directory as given. A root already reached from another one is only walked
+// from the root given first, a directory nested in it from its own root.
 func (walker *DirWalker) SetEntryPoint(directory string) {
-	walker.state.directoriesQueue.Push(directory)
+	identity, found := getDirectoryIdentity(directory)
+
+	if found {
+		if _, visited := walker.state.visitedDirectories[identity]; visited {
+			walker.stats.overlappingDirectories++
+			return
+		}
+
+		walker.state.visitedDirectories[identity] = struct{}{}
+	}
+
+	resolved, err := resolveDirectory(directory)
+	if err == nil {
+		walker.state.trees = append(walker.state.trees, resolved)
+	}
+
+	walker.pushDirectory(walkerDirectory{
+		ignore:       nil,
+		path:         directory,
+		root:         directory,
+		rootDevice:   identity.device,
+		parentDevice: identity.device,
+		device:       identity.device,
+		depth:        0,
+		isRoot:       true,
+		linked:       false,
+	})
+}
+
+func resolveDirectory(directory string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(directory)
+	if err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	return resolved, nil
+}
+
+// SetOrder chooses between breadth first (bfs) and depth first (dfs) walks,
+// directories already added keep their order.
+func (walker *DirWalker) SetOrder(order string) error {
+	container, err := newDirectoryContainer(order)
+	if err != nil {
+		return err
+	}
+
+	walker.state.mutex.Lock()
+	defer walker.state.mutex.Unlock()
+
+	waiting := make([]walkerDirectory, 0, walker.state.pending)
+	for !walker.state.directories.Empty() {
+		directory, err := walker.state.directories.Pop()
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		waiting = append(waiting, directory)
+	}
+
+	if order == depthFirstOrder {
+		slices.Reverse(waiting)
+	}
+
+	for _, directory := range waiting {
+		container.Push(directory)
+	}
+
+	walker.state.directories = container
+
+	return nil
+}
+
+// SetMaxDepth limits how many directory levels below each root are read, 0
+// only reads the roots and a negative depth doesn't limit the walk.
+func (walker *DirWalker) SetMaxDepth(depth int) {
+	walker.configuration.maxDepth = depth
+}
+
+// SetReaders bounds the number of directories listed at the same time.
+func (walker *DirWalker) SetReaders(readers int) {
+	walker.configuration.readers = max(readers, 1)
+}
+
+// SetOneFilesystem keeps the walker on the device of each root.
+func (walker *DirWalker) SetOneFilesystem(oneFilesystem bool) {
+	walker.configuration.oneFilesystem = oneFilesystem
+}
+
+// SetSkippedDevices sets the devices, mapped to their filesystem type, whose
+// mounts below a root are not read. The device of a root is always read.
+func (walker *DirWalker) SetSkippedDevices(devices map[uint64]string) {
+	walker.configuration.skippedDevices = devices
 }
 
 func (walker *DirWalker) SetDirectoryFilter(filterFn func(string) bool) {
 	walker.configuration.filterDirectory = filterFn
 }
 
+// SetPathFilter sets the -exclude and -include rules, nil lets every path in.
+func (walker *DirWalker) SetPathFilter(filter *pathFilter) {
+	walker.configuration.pathFilter = filter
+}
+
+// SetCandidateFilter sets the size, age and extension filters, nil lets every
+// file in.
+func (walker *DirWalker) SetCandidateFilter(candidates *candidateFilter) {
+	walker.configuration.candidates = candidates
+}
+
+// SetFollowSymlinks makes the walker scan the targets of symbolic links under
+// their resolved path. Links to a directory inside a root or a target already
+// followed are not followed, so link cycles end. Links without target are
+// collected in stats.danglingLinks.
+func (walker *DirWalker) SetFollowSymlinks(follow bool) {
+	walker.configuration.followSymlinks = follow
+}
+
 func (walker *DirWalker) SetFileCallback(callback func(FilesystemObject)) {
 	walker.configuration.fileCallback = callback
 }
 
+// SetDirectoryCallback sets a function called once every directory has been
+// read and its files handed to the file callback.
 func (walker *DirWalker) SetDirectoryCallback(callback func()) {
 	walker.configuration.directoryCallback = callback
 }
 
 func (walker *DirWalker) Walk() {
-	var formattedSize commons.FileSize
-	var objects []os.DirEntry
-	var err error
+	events := make(chan walkerEvent, 4*walker.configuration.readers)
+	readersWg := sync.WaitGroup{}
 
 	ui.AddNewNamedLine("directory-line", "Directories seen: %6d")
 	ui.AddNewNamedLine("file-line", "Files seen: %12d")
 	ui.AddNewNamedLine("size-line", "Processed: %10d %2s")
 
-	for !walker.state.directoriesQueue.Empty() {
-		walker.state.currentDirectory, err = walker.state.directoriesQueue.Pop()
-		if err != nil {
-			panic(err)
+	for range walker.configuration.readers {
+		readersWg.Add(1)
+
+		go func() {
+			defer readersWg.Done()
+			walker.readDirectories(events)
+		}()
+	}
+
+	go func() {
+		readersWg.Wait()
+		close(events)
+	}()
+
+	for event := range events {
+		if event.directoryDone {
+			walker.finishDirectory()
+		} else {
+			walker.dispatchFile(event.file)
 		}
+	}
+}
 
-		objects, err = os.ReadDir(walker.state.currentDirectory)
+func (walker *DirWalker) dispatchFile(file FilesystemObject) {
+	walker.state.mutex.Lock()
+	walker.stats.fileSeen++
+	walker.stats.sizeProcessed += file.infos.Size()
+	walker.state.mutex.Unlock()
 
-		if err == nil {
-			walker.processDirectoryItems(&objects)
+	walker.configuration.fileCallback(file)
+}
 
-			formattedSize, err = commons.FormatFileSize(walker.stats.sizeProcessed)
-			if err != nil {
-				panic(err)
-			}
+func (walker *DirWalker) finishDirectory() {
+	walker.state.mutex.Lock()
+	directoriesSeen := walker.stats.directoriesSeen
+	fileSeen := walker.stats.fileSeen
+	sizeProcessed := walker.stats.sizeProcessed
+	walker.state.mutex.Unlock()
 
-			ui.UpdateNamedLine("directory-line", walker.stats.directoriesSeen)
-			ui.UpdateNamedLine("file-line", walker.stats.fileSeen)
-			ui.UpdateNamedLine("size-line", formattedSize.Value, *formattedSize.Unit)
-		} else if !errors.Is(err, os.ErrPermission) {
-			panic(err)
-		}
+	formattedSize, err := commons.FormatFileSize(sizeProcessed)
+	if err != nil {
+		panic(err)
+	}
+
+	ui.UpdateNamedLine("directory-line", directoriesSeen)
+	ui.UpdateNamedLine("file-line", fileSeen)
+	ui.UpdateNamedLine("size-line", formattedSize.Value, *formattedSize.Unit)
 
+	if walker.configuration.directoryCallback != nil {
 		walker.configuration.directoryCallback()
 	}
 }
 
-func (walker *DirWalker) processDirectoryItems(objects *[]os.DirEntry) {
-	for _, obj := range *objects {
-		walker.state.currentFile = path.Join(walker.state.currentDirectory, obj.Name())
+func (walker *DirWalker) pushDirectory(directory walkerDirectory) {
+	walker.state.mutex.Lock()
+	defer walker.state.mutex.Unlock()
 
-		if obj.IsDir() {
-			walker.processDirectoryEntry(&walker.state.currentFile)
-		} else {
-			walker.processFileEntry(&obj)
+	walker.state.directories.Push(directory)
+	walker.state.pending++
+	walker.state.directoryAvailable.Signal()
+}
+
+// nextDirectory waits for a directory to read, false means the walk is over.
+func (walker *DirWalker) nextDirectory() (walkerDirectory, bool) {
+	walker.state.mutex.Lock()
+	defer walker.state.mutex.Unlock()
+
+	for walker.state.directories.Empty() && walker.state.pending > 0 {
+		walker.state.directoryAvailable.Wait()
+	}
+
+	if walker.state.directories.Empty() {
+		return walkerDirectory{}, false
+	}
+
+	directory, err := walker.state.directories.Pop()
+	if err != nil {
+		panic(err)
+	}
+
+	return directory, true
+}
+
+func (walker *DirWalker) directoryRead() {
+	walker.state.mutex.Lock()
+	defer walker.state.mutex.Unlock()
+
+	walker.state.pending--
+	if walker.state.pending == 0 {
+		walker.state.directoryAvailable.Broadcast()
+	}
+}
+
+func (walker *DirWalker) readDirectories(events chan<- walkerEvent) {
+	for {
+		directory, found := walker.nextDirectory()
+		if !found {
+			return
+		}
+
+		if !walker.skipDirectory(&directory) {
+			walker.readDirectory(&directory, events)
+		}
+
+		events <- walkerEvent{file: FilesystemObject{}, directoryDone: true}
+
+		walker.directoryRead()
+	}
+}
+
+func (walker *DirWalker) readDirectory(directory *walkerDirectory, events chan<- walkerEvent) {
+	var err error
+
+	if walker.configuration.pathFilter != nil && walker.configuration.pathFilter.honorIgnoreFiles {
+		directory.ignore, err = loadIgnoreRules(directory.path, directory.ignore)
+		if err != nil && !errors.Is(err, os.ErrPermission) {
+			walker.state.mutex.Lock()
+			walker.stats.ignoreFileErrors = append(walker.stats.ignoreFileErrors, err.Error())
+			walker.state.mutex.Unlock()
+		}
+	}
+
+	objects, err := os.ReadDir(directory.path)
+	if errors.Is(err, os.ErrPermission) {
+		return
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	for _, obj := range objects {
+		fullPath := path.Join(directory.path, obj.Name())
+
+		switch {
+		case obj.IsDir():
+			walker.processDirectoryEntry(directory, fullPath, false)
+		case obj.Type()&fs.ModeSymlink != 0 && walker.configuration.followSymlinks:
+			walker.processSymlinkEntry(directory, fullPath, events)
+		default:
+			walker.processFileEntry(directory, fullPath, obj, events)
 		}
 	}
 }
 
-func (walker *DirWalker) processDirectoryEntry(directory *string) {
-	if !walker.configuration.filterDirectory(*directory) {
+func getDirectoryIdentity(directory string) (directoryIdentity, bool) {
+	infos, err := os.Stat(directory)
+	if err != nil {
+		return directoryIdentity{device: 0, inode: 0}, false
+	}
+
+	stats := commons.Stats{FileInfo: infos}
+	device, deviceFound := stats.DeviceID()
+	inode, inodeFound := stats.Inode()
+
+	return directoryIdentity{device: device, inode: inode}, deviceFound && inodeFound
+}
+
+// skipDirectory tells whether directory was already read or lies on a
+// filesystem left out. Link targets and mount points are marked as visited,
+// other directories can only be reached again through them. Roots were marked
+// when added and directories whose identity is not available are always read.
+func (walker *DirWalker) skipDirectory(directory *walkerDirectory) bool {
+	if directory.isRoot {
+		return false
+	}
+
+	identity, found := getDirectoryIdentity(directory.path)
+	if !found {
+		return false
+	}
+
+	directory.device = identity.device
+
+	walker.state.mutex.Lock()
+	defer walker.state.mutex.Unlock()
+
+	if _, visited := walker.state.visitedDirectories[identity]; visited {
+		walker.stats.overlappingDirectories++
+		return true
+	}
+
+	if directory.linked || identity.device != directory.parentDevice {
+		walker.state.visitedDirectories[identity] = struct{}{}
+	}
+
+	_, skippedDevice := walker.configuration.skippedDevices[identity.device]
+	otherDevice := identity.device != directory.rootDevice
+
+	if otherDevice && (skippedDevice || walker.configuration.oneFilesystem) {
+		walker.stats.skippedMounts++
+		return true
+	}
+
+	return false
+}
+
+// allowedByRules applies the path filter and the ignore files to an entry of
+// directory.
+func (walker *DirWalker) allowedByRules(directory *walkerDirectory, fullPath string, isDirectory bool) bool {
+	filter := walker.configuration.pathFilter
+	if filter == nil {
+		return true
+	}
+
+	relative := relativeToRoot(fullPath, directory.root)
+
+	if isDirectory && !filter.allowsDirectory(relative) || !isDirectory && !filter.allowsFile(relative) {
+		return false
+	}
+
+	return !directory.ignore.excluded(fullPath, isDirectory)
+}
+
+func (walker *DirWalker) processSymlinkEntry(directory *walkerDirectory, link string, events chan<- walkerEvent) {
+	if !walker.allowedByRules(directory, link, false) {
+		return
+	}
+
+	target, err := filepath.EvalSymlinks(link)
+
+	var infos fs.FileInfo
+	if err == nil {
+		infos, err = os.Stat(target)
+	}
+
+	if errors.Is(err, os.ErrPermission) {
+		return
+	}
+
+	if err != nil {
+		walker.state.mutex.Lock()
+		walker.stats.danglingLinks = append(walker.stats.danglingLinks, link)
+		walker.state.mutex.Unlock()
+
 		return
 	}
 
+	if infos.IsDir() {
+		walker.processLinkedDirectory(directory, target)
+	} else {
+		walker.processFileInfo(directory, target, infos, events)
+	}
+}
+
+// processLinkedDirectory follows a link to a directory unless the target lies
+// in a root or in a target already followed, from where it is read.
+func (walker *DirWalker) processLinkedDirectory(directory *walkerDirectory, target string) {
+	resolved, err := filepath.Abs(target)
+	if err != nil {
+		panic(err)
+	}
+
+	walker.state.mutex.Lock()
+
+	for _, tree := range walker.state.trees {
+		if isInsideDirectory(resolved, tree) {
+			walker.stats.overlappingDirectories++
+			walker.state.mutex.Unlock()
+
+			return
+		}
+	}
+
+	walker.state.mutex.Unlock()
+
+	if walker.processDirectoryEntry(directory, target, true) {
+		walker.state.mutex.Lock()
+		walker.state.trees = append(walker.state.trees, resolved)
+		walker.state.mutex.Unlock()
+	}
+}
+
+// processDirectoryEntry queues a subdirectory allowed by the depth limit and
+// the filters, and tells whether it was queued.
+func (walker *DirWalker) processDirectoryEntry(directory *walkerDirectory, fullPath string, linked bool) bool {
+	maxDepth := walker.configuration.maxDepth
+	if maxDepth >= 0 && directory.depth >= maxDepth {
+		return false
+	}
+
+	if !walker.configuration.filterDirectory(fullPath) || !walker.allowedByRules(directory, fullPath, true) {
+		return false
+	}
+
+	walker.state.mutex.Lock()
 	walker.stats.directoriesSeen++
-	walker.state.directoriesQueue.Push(*directory)
+	walker.state.mutex.Unlock()
+
+	walker.pushDirectory(walkerDirectory{
+		ignore:       directory.ignore,
+		path:         fullPath,
+		root:         directory.root,
+		rootDevice:   directory.rootDevice,
+		parentDevice: directory.device,
+		device:       0,
+		depth:        directory.depth + 1,
+		isRoot:       false,
+		linked:       linked,
+	})
+
+	return true
 }
 
-func (walker *DirWalker) processFileEntry(obj *os.DirEntry) {
-	infos, err := (*obj).Info()
+func (walker *DirWalker) processFileEntry(
+	directory *walkerDirectory,
+	fullPath string,
+	obj os.DirEntry,
+	events chan<- walkerEvent,
+) {
+	infos, err := obj.Info()
 	if err != nil {
 		panic(err)
 	}
 
+	walker.processFileInfo(directory, fullPath, infos, events)
+}
+
+func (walker *DirWalker) processFileInfo(
+	directory *walkerDirectory,
+	fullPath string,
+	infos fs.FileInfo,
+	events chan<- walkerEvent,
+) {
+	if !walker.allowedByRules(directory, fullPath, false) {
+		return
+	}
+
 	file := FilesystemObject{
 		infos: infos,
-		path:  walker.state.currentFile,
+		path:  fullPath,
+		root:  directory.root,
 	}
 
 	isFileAlloewd, err := file.IsAllowed()
@@ -157,7 +658,10 @@ func (walker *DirWalker) processFileEntry(obj *os.DirEntry) {
 		return
 	}
 
-	walker.stats.fileSeen++
-	walker.stats.sizeProcessed += file.infos.Size()
-	walker.configuration.fileCallback(file)
+	candidates := walker.configuration.candidates
+	if candidates != nil && !candidates.allows(file.path, file.infos.Size(), file.infos.ModTime()) {
+		return
+	}
+
+	events <- walkerEvent{file: file, directoryDone: false}
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirWalker_OneFilesystem_StopsAtOtherDevice(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{"file": "data"})
+
+	if _, err := os.Stat("/proc/self/fdinfo"); err != nil {
+		t.Skip("no /proc:", err)
+	}
+
+	if err := os.Symlink("/proc/self/fdinfo", filepath.Join(baseDir, "proc")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	walker := NewWalker(false)
+	walker.SetEntryPoint(baseDir)
+	walker.SetDirectoryFilter(func(_ string) bool {
+		return true
+	})
+	walker.SetFollowSymlinks(true)
+	walker.SetOneFilesystem(true)
+
+	walked := 0
+	walker.SetFileCallback(func(_ FilesystemObject) {
+		walked++
+	})
+	walker.SetDirectoryCallback(func() {})
+	walker.Walk()
+
+	if walked != 1 || walker.stats.skippedMounts != 1 {
+		t.Errorf("expected 1 file and 1 skipped mount, got %d and %d", walked, walker.stats.skippedMounts)
+	}
+}
+
+func TestDirWalker_SkippedDevices_MountBelowRootSkipped(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{"file": "data"})
+
+	identity, found := getDirectoryIdentity("/proc/self/fdinfo")
+	if !found {
+		t.Skip("no /proc")
+	}
+
+	if err := os.Symlink("/proc/self/fdinfo", filepath.Join(baseDir, "proc")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	walker := NewWalker(false)
+	walker.SetEntryPoint(baseDir)
+	walker.SetDirectoryFilter(func(_ string) bool {
+		return true
+	})
+	walker.SetFollowSymlinks(true)
+	walker.SetSkippedDevices(map[uint64]string{identity.device: "proc"})
+
+	walked := 0
+	walker.SetFileCallback(func(_ FilesystemObject) {
+		walked++
+	})
+	walker.SetDirectoryCallback(func() {})
+	walker.Walk()
+
+	if walked != 1 || walker.stats.skippedMounts != 1 {
+		t.Errorf("expected 1 file and 1 skipped mount, got %d and %d", walked, walker.stats.skippedMounts)
+	}
+}
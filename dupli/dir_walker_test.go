@@ -1,8 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sync/atomic"
 	"testing"
 )
 
@@ -133,3 +138,366 @@ func TestDirWalker_NoSkipEmptyFiles(t *testing.T) {
 		t.Errorf("expected 2 files processed, got %d", len(processedFiles))
 	}
 }
+
+func walkRoots(t *testing.T, roots ...string) (map[string]string, dirwalkerStatistics) {
+	t.Helper()
+
+	walker := NewWalker(false)
+	for _, root := range roots {
+		walker.SetEntryPoint(root)
+	}
+
+	walker.SetDirectoryFilter(func(_ string) bool {
+		return true
+	})
+
+	fileRoots := make(map[string]string)
+	walker.SetFileCallback(func(info FilesystemObject) {
+		if _, found := fileRoots[info.path]; found {
+			t.Errorf("file walked twice: %s", info.path)
+		}
+
+		fileRoots[info.path] = info.root
+	})
+
+	walker.SetDirectoryCallback(func() {})
+	walker.Walk()
+
+	return fileRoots, walker.stats
+}
+
+func TestDirWalker_NestedRootsWalkedOnce(t *testing.T) {
+	baseDir := t.TempDir()
+	nested := filepath.Join(baseDir, "nested")
+
+	if err := os.Mkdir(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(baseDir, "top"), []byte("top"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(nested, "inner"), []byte("inner"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fileRoots, stats := walkRoots(t, baseDir, nested)
+
+	if len(fileRoots) != 2 || stats.fileSeen != 2 {
+		t.Fatalf("expected 2 files, got %v", fileRoots)
+	}
+
+	if fileRoots[filepath.Join(baseDir, "top")] != baseDir {
+		t.Errorf("unexpected root of top: %q", fileRoots[filepath.Join(baseDir, "top")])
+	}
+
+	if fileRoots[filepath.Join(nested, "inner")] != nested {
+		t.Errorf("unexpected root of inner: %q", fileRoots[filepath.Join(nested, "inner")])
+	}
+
+	if stats.overlappingDirectories != 1 {
+		t.Errorf("expected 1 overlapping directory, got %d", stats.overlappingDirectories)
+	}
+}
+
+func TestDirWalker_SameRootThroughAnotherPathWalkedOnce(t *testing.T) {
+	baseDir := t.TempDir()
+	target := filepath.Join(baseDir, "target")
+	alias := filepath.Join(baseDir, "alias")
+
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "file"), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, alias); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	fileRoots, stats := walkRoots(t, target, alias)
+
+	if len(fileRoots) != 1 || fileRoots[filepath.Join(target, "file")] != target {
+		t.Errorf("expected the file once from %s, got %v", target, fileRoots)
+	}
+
+	if stats.overlappingDirectories != 1 {
+		t.Errorf("expected 1 overlapping directory, got %d", stats.overlappingDirectories)
+	}
+}
+
+func TestDirWalker_FollowSymlinks_CyclesAndDanglingLinks(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{"tree/file": "data"})
+	outside := writeTestTree(t, map[string]string{"external": "data"})
+	tree := filepath.Join(baseDir, "tree")
+
+	links := map[string]string{
+		filepath.Join(tree, "loop"):     tree,
+		filepath.Join(tree, "dangling"): filepath.Join(baseDir, "missing"),
+		filepath.Join(tree, "outside"):  outside,
+		filepath.Join(tree, "alias"):    filepath.Join(tree, "file"),
+	}
+
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+
+	for _, follow := range []bool{false, true} {
+		walker := NewWalker(false)
+		walker.SetEntryPoint(tree)
+		walker.SetDirectoryFilter(func(_ string) bool {
+			return true
+		})
+		walker.SetFollowSymlinks(follow)
+
+		walked := make(map[string]bool)
+		walker.SetFileCallback(func(info FilesystemObject) {
+			walked[info.path] = true
+		})
+		walker.SetDirectoryCallback(func() {})
+		walker.Walk()
+
+		resolvedTree, err := filepath.EvalSymlinks(tree)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resolvedOutside, err := filepath.EvalSymlinks(outside)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]bool{filepath.Join(tree, "file"): true}
+		expectedDangling := 0
+
+		if follow {
+			expected[filepath.Join(resolvedTree, "file")] = true
+			expected[filepath.Join(resolvedOutside, "external")] = true
+			expectedDangling = 1
+		}
+
+		if !reflect.DeepEqual(walked, expected) {
+			t.Errorf("follow %v: expected %v, got %v", follow, expected, walked)
+		}
+
+		if len(walker.stats.danglingLinks) != expectedDangling {
+			t.Errorf("follow %v: expected %d dangling links, got %v", follow, expectedDangling, walker.stats.danglingLinks)
+		}
+	}
+}
+
+func TestDirWalker_SkippedDevices_RootFilesystemRead(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{"top": "data", "sub/inner": "data"})
+
+	identity, found := getDirectoryIdentity(baseDir)
+	if !found {
+		t.Skip("directory identity not available")
+	}
+
+	walker := NewWalker(false)
+	walker.SetEntryPoint(baseDir)
+	walker.SetDirectoryFilter(func(_ string) bool {
+		return true
+	})
+	walker.SetSkippedDevices(map[uint64]string{identity.device: "testfs"})
+
+	walked := make([]string, 0)
+	walker.SetFileCallback(func(info FilesystemObject) {
+		walked = append(walked, filepath.Base(info.path))
+	})
+	walker.SetDirectoryCallback(func() {})
+	walker.Walk()
+
+	if !reflect.DeepEqual(walked, []string{"top", "inner"}) || walker.stats.skippedMounts != 0 {
+		t.Errorf("expected top, inner and no skipped mount, got %v and %d", walked, walker.stats.skippedMounts)
+	}
+}
+
+func TestDirWalker_ParallelReaders_SerialCallbacks(t *testing.T) {
+	files := make(map[string]string)
+	for directory := range 20 {
+		for file := range 5 {
+			files[filepath.Join(fmt.Sprintf("d%02d", directory), fmt.Sprintf("sub/f%d", file))] = "data"
+		}
+	}
+
+	baseDir := writeTestTree(t, files)
+
+	walker := NewWalker(false)
+	walker.SetEntryPoint(baseDir)
+	walker.SetReaders(6)
+	walker.SetDirectoryFilter(func(_ string) bool {
+		return true
+	})
+
+	inCallback := atomic.Bool{}
+	walked := make(map[string]bool)
+	directories := 0
+
+	walker.SetFileCallback(func(info FilesystemObject) {
+		if !inCallback.CompareAndSwap(false, true) {
+			t.Error("file callback called concurrently")
+		}
+
+		walked[info.path] = true
+		inCallback.Store(false)
+	})
+	walker.SetDirectoryCallback(func() {
+		directories++
+	})
+	walker.Walk()
+
+	if len(walked) != len(files) || walker.stats.fileSeen != len(files) {
+		t.Errorf("expected %d files, got %d", len(files), len(walked))
+	}
+
+	// the root, 20 directories and their sub directories
+	if directories != 41 || walker.stats.directoriesSeen != 40 {
+		t.Errorf("expected 41 directories done and 40 seen, got %d and %d", directories, walker.stats.directoriesSeen)
+	}
+}
+
+func walkInOrder(t *testing.T, baseDir string, order string, maxDepth int) []string {
+	t.Helper()
+
+	walker := NewWalker(false)
+	walker.SetEntryPoint(baseDir)
+	walker.SetReaders(1)
+	walker.SetMaxDepth(maxDepth)
+	walker.SetDirectoryFilter(func(_ string) bool {
+		return true
+	})
+
+	err := walker.SetOrder(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walked := make([]string, 0)
+	walker.SetFileCallback(func(info FilesystemObject) {
+		relative, err := filepath.Rel(baseDir, info.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		walked = append(walked, filepath.ToSlash(relative))
+	})
+	walker.Walk()
+
+	return walked
+}
+
+func TestDirWalker_Order_BreadthAndDepthFirst(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{
+		"top":       "data",
+		"a/f":       "data",
+		"a/sub/f":   "data",
+		"b/f":       "data",
+		"b/sub/f":   "data",
+		"b/sub/x/f": "data",
+	})
+
+	expected := map[string][]string{
+		breadthFirstOrder: {"top", "a/f", "b/f", "a/sub/f", "b/sub/f", "b/sub/x/f"},
+		depthFirstOrder:   {"top", "b/f", "b/sub/f", "b/sub/x/f", "a/f", "a/sub/f"},
+	}
+
+	for order, files := range expected {
+		walked := walkInOrder(t, baseDir, order, unlimitedDepth)
+		if !slices.Equal(walked, files) {
+			t.Errorf("%s: expected %v, got %v", order, files, walked)
+		}
+	}
+}
+
+func TestDirWalker_MaxDepth(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{
+		"top":     "data",
+		"a/f":     "data",
+		"a/sub/f": "data",
+	})
+
+	expected := map[int][]string{
+		0: {"top"},
+		1: {"top", "a/f"},
+		2: {"top", "a/f", "a/sub/f"},
+	}
+
+	for _, order := range []string{breadthFirstOrder, depthFirstOrder} {
+		for depth, files := range expected {
+			walked := walkInOrder(t, baseDir, order, depth)
+			if !slices.Equal(walked, files) {
+				t.Errorf("%s with depth %d: expected %v, got %v", order, depth, files, walked)
+			}
+		}
+	}
+}
+
+func TestDirWalker_SetOrder_Unsupported(t *testing.T) {
+	err := NewWalker(false).SetOrder("random")
+	if !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("expected invalid argument error, got %v", err)
+	}
+}
+
+func TestDirWalker_DepthFirst_BoundedMemory(t *testing.T) {
+	const width = 12
+
+	files := make(map[string]string)
+	for directory := range width {
+		for sub := range width {
+			files[fmt.Sprintf("d%02d/s%02d/file", directory, sub)] = "data"
+		}
+	}
+
+	baseDir := writeTestTree(t, files)
+	outside := writeTestTree(t, map[string]string{"inner/external": "data"})
+
+	for link, target := range map[string]string{"d00/outside": outside, "d01/loop": baseDir} {
+		if err := os.Symlink(target, filepath.Join(baseDir, link)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+
+	peaks := make(map[string]int)
+
+	for _, order := range []string{breadthFirstOrder, depthFirstOrder} {
+		walker := NewWalker(false)
+		walker.SetEntryPoint(baseDir)
+		walker.SetReaders(1)
+		walker.SetFollowSymlinks(true)
+		walker.SetDirectoryFilter(func(_ string) bool {
+			return true
+		})
+
+		err := walker.SetOrder(order)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		walked := 0
+		walker.SetFileCallback(func(_ FilesystemObject) {
+			walked++
+		})
+		walker.SetDirectoryCallback(func() {
+			walker.state.mutex.Lock()
+			peaks[order] = max(peaks[order], walker.state.pending)
+			walker.state.mutex.Unlock()
+		})
+		walker.Walk()
+
+		if walked != len(files)+1 {
+			t.Errorf("%s: expected %d files, got %d", order, len(files)+1, walked)
+		}
+
+		// the root and the followed link target, not every directory read
+		if len(walker.state.visitedDirectories) != 2 {
+			t.Errorf("%s: expected 2 directories remembered, got %d", order, len(walker.state.visitedDirectories))
+		}
+	}
+
+	if peaks[depthFirstOrder] > 2*width+2 || peaks[breadthFirstOrder] < width*width {
+		t.Errorf("expected depth first to hold at most %d directories and breadth first a whole level, got %v", 2*width+2, peaks)
+	}
+}
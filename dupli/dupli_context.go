@@ -2,7 +2,7 @@ package main
 
 import (
 	"fmt"
-	"sync"
+	"os"
 
 	"archive-tools-monorepo/commons"
 	datastructures "archive-tools-monorepo/dataStructures"
@@ -11,13 +11,13 @@ import (
 type DupliContext struct {
 	heap         *datastructures.Heap[commons.File]
 	hashRegistry *datastructures.Flyweight[string]
-	sizeFilter   sync.Map
+	hasher       commons.Hasher
+	cache        *hashCache
 }
 
 type DupliContextFunction func(*DupliContext) error
 
 // TODO:
-// - make sizeFilter optional
 // - convert the function running on heap to methods on context
 
 func WithExistingHeap(heap *datastructures.Heap[commons.File]) DupliContextFunction {
@@ -34,6 +34,25 @@ func WithExistingRegistry(registry *datastructures.Flyweight[string]) DupliConte
 	}
 }
 
+func WithHasher(hasher commons.Hasher) DupliContextFunction {
+	return func(dc *DupliContext) error {
+		if hasher == nil {
+			return fmt.Errorf("%w: hasher is a nil pointer", os.ErrInvalid)
+		}
+
+		dc.hasher = hasher
+		return nil
+	}
+}
+
+// WithHashCache sets the cache looked up before hashing, nil disables it.
+func WithHashCache(cache *hashCache) DupliContextFunction {
+	return func(dc *DupliContext) error {
+		dc.cache = cache
+		return nil
+	}
+}
+
 func WithNewHeap(sortFn datastructures.HeapCompareFn[commons.File]) DupliContextFunction {
 	newHeap, err := datastructures.NewHeap(
 		datastructures.WithComapreFn(sortFn),
@@ -54,7 +73,8 @@ func defaultContext() DupliContext {
 	return DupliContext{
 		heap:         nil,
 		hashRegistry: nil,
-		sizeFilter:   sync.Map{},
+		hasher:       nil,
+		cache:        nil,
 	}
 }
 
@@ -76,42 +96,142 @@ func newDupliContext(optsFn ...DupliContextFunction) (*DupliContext, error) {
 	return &dupliContext, nil
 }
 
-func (dupliCtx *DupliContext) Display() error {
-	var lastSeen commons.File
+func (dupliCtx *DupliContext) forEachGroup(groupFn func(*duplicateGroup) error) error {
 	var current commons.File
-	var areEqual bool
 	var err error
 
-	isDuplicate := false
+	group := newDuplicateGroup()
+	group.id = 1
 
-	if !dupliCtx.heap.Empty() {
+	for !dupliCtx.heap.Empty() {
 		current, err = dupliCtx.heap.Pop()
 		if err != nil {
 			return fmt.Errorf("%w", err)
 		}
+
+		if len(group.files) > 0 && !commons.WeakFileEqulity(&current, &group.files[0]) {
+			err = group.flush(groupFn)
+			if err != nil {
+				return err
+			}
+		}
+
+		group.files = append(group.files, current)
 	}
 
-	for !dupliCtx.heap.Empty() {
-		lastSeen = current
-		current, err = dupliCtx.heap.Pop()
+	return group.flush(groupFn)
+}
+
+func (dupliCtx *DupliContext) collectGroups() ([]duplicateGroup, error) {
+	groups := make([]duplicateGroup, 0)
+
+	err := dupliCtx.forEachGroup(func(group *duplicateGroup) error {
+		groups = append(groups, *group)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	return groups, nil
+}
+
+// Process streams every duplicate group to the reporter and then hands it to
+// the requested action, the heap is drained in the process.
+func (dupliCtx *DupliContext) Process(output reporter, action groupAction, metadata scanMetadata) error {
+	return processGroups(dupliCtx.forEachGroup, nil, output, action, metadata)
+}
+
+// ProcessVerified compares the members of every group byte by byte first,
+// only byte-identical files are reported as duplicates and handed to the
+// action, hash groups whose content differs are reported as mismatches and
+// files that can't be read are logged and listed in the metadata.
+func (dupliCtx *DupliContext) ProcessVerified(
+	output reporter,
+	action groupAction,
+	metadata scanMetadata,
+	logFn func(string, ...any),
+) error {
+	verified, mismatches, unreadable, err := dupliCtx.collectVerifiedGroups(logFn)
+	if err != nil {
+		return err
+	}
+
+	if len(unreadable) > 0 {
+		metadata.Unverified = unreadable
+	}
+
+	forEachVerified := func(groupFn func(*duplicateGroup) error) error {
+		for index := range verified {
+			err := groupFn(&verified[index])
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return processGroups(forEachVerified, mismatches, output, action, metadata)
+}
+
+func (dupliCtx *DupliContext) collectVerifiedGroups(
+	logFn func(string, ...any),
+) ([]duplicateGroup, []duplicateGroup, []unverifiedFile, error) {
+	groups, err := dupliCtx.collectGroups()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	results, err := verifyGroups(groups)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	verified, mismatches, unreadable := splitVerifiedGroups(results)
+
+	for _, file := range unreadable {
+		logFn("could not verify %s, left out: %s", file.Path, file.Error)
+	}
+
+	return verified, mismatches, unreadable, nil
+}
+
+func processGroups(
+	forEach func(func(*duplicateGroup) error) error,
+	mismatches []duplicateGroup,
+	output reporter,
+	action groupAction,
+	metadata scanMetadata,
+) error {
+	err := output.Begin(metadata)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	err = forEach(func(group *duplicateGroup) error {
+		err = output.Group(group)
 		if err != nil {
 			return fmt.Errorf("%w", err)
 		}
 
-		areEqual = commons.WeakFileEqulity(&current, &lastSeen)
+		return action.Apply(group)
+	})
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
 
-		if areEqual {
-			ui.Println("file: %s", &lastSeen)
-		} else if isDuplicate {
-			ui.Println("file: %s", &lastSeen)
+	for index := range mismatches {
+		err = output.Mismatch(&mismatches[index])
+		if err != nil {
+			return fmt.Errorf("%w", err)
 		}
-
-		isDuplicate = areEqual
 	}
 
-	if isDuplicate {
-		ui.Println("file: %s", &lastSeen)
+	err = output.End()
+	if err != nil {
+		return fmt.Errorf("%w", err)
 	}
 
-	return nil
+	return action.Close()
 }
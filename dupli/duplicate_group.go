@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"archive-tools-monorepo/commons"
+)
+
+type duplicateGroup struct {
+	hash  string
+	files []commons.File
+	size  int64
+	id    int
+}
+
+func newDuplicateGroup() duplicateGroup {
+	return duplicateGroup{
+		hash:  "",
+		files: make([]commons.File, 0),
+		size:  0,
+		id:    0,
+	}
+}
+
+// flush hands the accumulated files to groupFn when they form a duplicate
+// group, then resets the group so it can collect the next run of files.
+// Group ids are only consumed by runs that are actually reported.
+func (group *duplicateGroup) flush(groupFn func(*duplicateGroup) error) error {
+	defer func() {
+		group.files = make([]commons.File, 0)
+	}()
+
+	if len(group.files) < 2 {
+		return nil
+	}
+
+	defer func() {
+		group.id++
+	}()
+
+	group.hash = group.files[0].Hash.Value()
+	group.size = group.files[0].Size
+
+	err := groupFn(group)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
+
+func (group *duplicateGroup) paths() []string {
+	output := make([]string, len(group.files))
+
+	for index := range group.files {
+		output[index] = group.files[index].Name
+	}
+
+	return output
+}
+
+func (group *duplicateGroup) roots() []string {
+	output := make([]string, len(group.files))
+
+	for index := range group.files {
+		output[index] = group.files[index].Root
+	}
+
+	return output
+}
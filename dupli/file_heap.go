@@ -8,18 +8,18 @@ import (
 	datastructures "archive-tools-monorepo/dataStructures"
 )
 
-func refineFile(file commons.File, fileChannel chan<- commons.File, flyweight *datastructures.Flyweight[string]) error {
-	if file.Hash.Value() != "" {
-		fileChannel <- file
-		return nil
-	}
-
-	hash, err := commons.GetSHA1HashFromPath(file.Name)
+func refineFile(
+	file commons.File,
+	fileChannel chan<- commons.File,
+	dupliCtx *DupliContext,
+	stage *hashStage,
+) error {
+	hash, err := stage.hash(dupliCtx.hasher, dupliCtx.cache, &file)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
-	file.Hash, err = flyweight.Instance(hash)
+	file.Hash, err = dupliCtx.hashRegistry.Instance(hash)
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
@@ -30,10 +30,19 @@ func refineFile(file commons.File, fileChannel chan<- commons.File, flyweight *d
 
 func getFileHashGoruotine(
 	fileChannel chan<- commons.File,
-	flyweight *datastructures.Flyweight[string],
+	dupliCtx *DupliContext,
+	stage *hashStage,
 ) func(commons.File) error {
 	return func(obj commons.File) error {
-		return refineFile(obj, fileChannel, flyweight)
+		return refineFile(obj, fileChannel, dupliCtx, stage)
+	}
+}
+
+// submitWhenIdle retries while every worker is busy, Submit gives up after a
+// few seconds which is shorter than hashing or comparing a large file.
+func submitWhenIdle[T any](pool *commons.WriteOnlyThreadPool[T], data T) {
+	for pool.Submit(data) != nil {
+		continue
 	}
 }
 
@@ -55,42 +64,67 @@ func consumeFromFileChannel(
 func (dupliCtx *DupliContext) filterHeap(
 	filterFunction func(*commons.File, *commons.File) bool,
 	registry *datastructures.Flyweight[string],
-) *DupliContext {
-	var current commons.File
-	var last commons.File
-
+	stage *hashStage,
+) (*DupliContext, error) {
 	output, err := newDupliContext(
 		WithNewHeap(commons.StrongFileCompare),
 		WithExistingRegistry(registry),
+		WithHasher(dupliCtx.hasher),
+		WithHashCache(dupliCtx.cache),
 	)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	output.hashRegistry = dupliCtx.hashRegistry
 
-	total := float64(dupliCtx.heap.Size())
-	processed := 0.0
-
-	duplicateFlag := false
-
 	fileChannel := make(chan commons.File)
-	targetFunction := getFileHashGoruotine(fileChannel, output.hashRegistry)
+	targetFunction := getFileHashGoruotine(fileChannel, output, stage)
 	fileThreadPool, err := commons.NewWorkerPool(targetFunction)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w", err)
 	}
 
 	outputWaitgroup := sync.WaitGroup{}
 	outputWaitgroup.Add(1)
 	go consumeFromFileChannel(fileChannel, &outputWaitgroup, output.heap)
 
-	ui.AddNewNamedLine("cleanup-stage", "Removing unique entries %s ... %.1f %%")
+	ui.AddNewNamedLine(stage.name, "Removing unique entries, %s ... %.1f %%")
+
+	err = dupliCtx.submitDuplicates(filterFunction, fileThreadPool, stage)
+
+	fileThreadPool.Release()
+	close(fileChannel)
+	outputWaitgroup.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// submitDuplicates hands to the pool every file equal to one of its
+// neighbours in the heap. Hashing large files can keep every worker busy past
+// the submit timeout, so submissions wait for an idle worker.
+func (dupliCtx *DupliContext) submitDuplicates(
+	filterFunction func(*commons.File, *commons.File) bool,
+	pool *commons.WriteOnlyThreadPool[commons.File],
+	stage *hashStage,
+) error {
+	var current commons.File
+	var last commons.File
+	var err error
+
+	total := float64(dupliCtx.heap.Size())
+	processed := 0.0
+
+	duplicateFlag := false
 
 	if !dupliCtx.heap.Empty() {
 		current, err = dupliCtx.heap.Pop()
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("%w", err)
 		}
 
 		processed += 1.0
@@ -100,7 +134,7 @@ func (dupliCtx *DupliContext) filterHeap(
 		last = current
 		current, err = dupliCtx.heap.Pop()
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("%w", err)
 		}
 
 		processed += 1.0
@@ -108,31 +142,20 @@ func (dupliCtx *DupliContext) filterHeap(
 		switch {
 		case filterFunction(&current, &last):
 			duplicateFlag = true
-			err = fileThreadPool.Submit(last)
+			submitWhenIdle(pool, last)
 		case duplicateFlag:
 			duplicateFlag = false
-			err = fileThreadPool.Submit(last)
+			submitWhenIdle(pool, last)
 		default:
 			duplicateFlag = false
 		}
 
-		if err != nil {
-			panic(err)
-		}
-
-		ui.UpdateNamedLine("cleanup-stage", "cleanup-stage", (processed/total)*100)
+		ui.UpdateNamedLine(stage.name, stage.name, (processed/total)*100)
 	}
 
 	if duplicateFlag {
-		err = fileThreadPool.Submit(current)
-		if err != nil {
-			panic(err)
-		}
+		submitWhenIdle(pool, current)
 	}
 
-	fileThreadPool.Release()
-	close(fileChannel)
-	outputWaitgroup.Wait()
-
-	return output
+	return nil
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestTree creates files, keyed by slash separated paths relative to a
+// new temporary directory, and returns this directory.
+func writeTestTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	baseDir := t.TempDir()
+
+	for name, content := range files {
+		fullPath := filepath.Join(baseDir, filepath.FromSlash(name))
+
+		err := os.MkdirAll(filepath.Dir(fullPath), 0o755)
+		if err == nil {
+			err = os.WriteFile(fullPath, []byte(content), 0o644)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return baseDir
+}
@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
-	"sync"
 
 	"archive-tools-monorepo/commons"
 	datastructures "archive-tools-monorepo/dataStructures"
@@ -21,11 +21,10 @@ const (
 	invalid   = iota
 )
 
-var ignoredDir = [...]string{"/dev", "/run", "/proc", "/sys"}
-
 type FilesystemObject struct {
 	infos fs.FileInfo
 	path  string
+	root  string
 }
 
 func (f *FilesystemObject) CanBeRead() (bool, error) {
@@ -86,7 +85,6 @@ func processFileEntry(
 	file *FilesystemObject,
 	fileChannel chan<- commons.File,
 	flyweight *datastructures.Flyweight[string],
-	sizeFilter *sync.Map,
 ) error {
 	var err error
 
@@ -107,26 +105,28 @@ func processFileEntry(
 		return fmt.Errorf("%w: file can't be read", os.ErrInvalid)
 	}
 
-	hash := ""
+	// files are hashed later on, only when their size is shared
 	size := file.infos.Size()
-	_, loaded := sizeFilter.LoadOrStore(size, true)
-
-	if size < 5000000 && loaded {
-		hash, err = commons.GetSHA1HashFromPath(file.path)
-		if err != nil {
-			return fmt.Errorf("%w", err)
-		}
-	}
-
-	hashPointer, err := flyweight.Instance(hash)
+	hashPointer, err := flyweight.Instance("")
 	if err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
+	stats := commons.Stats{FileInfo: file.infos}
+	device, _ := stats.DeviceID()
+	inode, _ := stats.Inode()
+	changeTime, _ := stats.ChangeTime()
+
 	fileStats := commons.File{
-		Name: file.path,
-		Size: size,
-		Hash: hashPointer,
+		Name:       file.path,
+		Root:       file.root,
+		Links:      nil,
+		Size:       size,
+		Hash:       hashPointer,
+		ModTime:    file.infos.ModTime(),
+		ChangeTime: changeTime,
+		Device:     device,
+		Inode:      inode,
 	}
 
 	fileChannel <- fileStats
@@ -136,14 +136,13 @@ func processFileEntry(
 func getFileProcessWorker(
 	flyweight *datastructures.Flyweight[string],
 	fileChannel chan<- commons.File,
-	sizeFilter *sync.Map,
 ) (func(FilesystemObject) error, error) {
 	if flyweight == nil {
 		return nil, fmt.Errorf("%w: flyweight is a nil pointer", os.ErrInvalid)
 	}
 
 	return func(file FilesystemObject) error {
-		return processFileEntry(&file, fileChannel, flyweight, sizeFilter)
+		return processFileEntry(&file, fileChannel, flyweight)
 	}, nil
 }
 
@@ -157,12 +156,18 @@ func checkIfDirIsAllowed(fullPath *string, userBlacklist *[]string) bool {
 	}
 
 	allowed := true
-	for index := range ignoredDir {
-		allowed = allowed && !strings.Contains(*fullPath, ignoredDir[index])
-	}
+	components := strings.Split(filepath.ToSlash(*fullPath), "/")
+
+	// absolute entries skip one directory, the others any directory whose
+	// path contains their components
+	for _, directory := range *userBlacklist {
+		if filepath.IsAbs(directory) {
+			allowed = allowed && !isInsideDirectory(*fullPath, directory)
+			continue
+		}
 
-	for index := range *userBlacklist {
-		allowed = allowed && !strings.Contains(*fullPath, (*userBlacklist)[index])
+		pattern := append([]string{anyComponents}, strings.Split(strings.Trim(filepath.ToSlash(directory), "/"), "/")...)
+		allowed = allowed && !matchComponents(append(pattern, anyComponents), components)
 	}
 
 	return allowed
@@ -196,10 +201,9 @@ func getFileCallback(tp *commons.WriteOnlyThreadPool[FilesystemObject]) func(fil
 		panic("threadpool is nil")
 	}
 
+	// the walker streams files without waiting for the pool between
+	// directories, a busy pool only slows it down
 	return func(file FilesystemObject) {
-		err := tp.Submit(file)
-		if err != nil {
-			panic(err)
-		}
+		submitWhenIdle(tp, file)
 	}
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"archive-tools-monorepo/commons"
+	datastructures "archive-tools-monorepo/dataStructures"
+)
+
+type fileIdentity struct {
+	device uint64
+	inode  uint64
+}
+
+// hardlinkMerger folds the paths sharing a device and inode into a single
+// file named after the smallest path, so that hardlinks are hashed once and
+// never reported as duplicates of each other. Files without inode are kept
+// as they are.
+type hardlinkMerger struct {
+	files       []commons.File
+	positions   map[fileIdentity]int
+	linkedPaths int
+}
+
+func newHardlinkMerger() *hardlinkMerger {
+	return &hardlinkMerger{
+		files:       make([]commons.File, 0),
+		positions:   make(map[fileIdentity]int),
+		linkedPaths: 0,
+	}
+}
+
+func (merger *hardlinkMerger) add(file commons.File) {
+	if file.Inode == 0 {
+		merger.files = append(merger.files, file)
+		return
+	}
+
+	identity := fileIdentity{device: file.Device, inode: file.Inode}
+
+	position, found := merger.positions[identity]
+	if !found {
+		merger.positions[identity] = len(merger.files)
+		merger.files = append(merger.files, file)
+
+		return
+	}
+
+	// a file reached again through a followed symlink is the same path
+	merged := &merger.files[position]
+	if file.Name == merged.Name || slices.Contains(merged.Links, file.Name) {
+		return
+	}
+
+	paths := append(append([]string{file.Name}, file.Links...), merged.Links...)
+
+	if file.Name < merged.Name {
+		paths[0] = merged.Name
+		merged.Name = file.Name
+		merged.Root = file.Root
+	}
+
+	merged.Links = paths
+	merger.linkedPaths += 1 + len(file.Links)
+}
+
+// pushAll moves the merged files into the heap, links sorted by path.
+func (merger *hardlinkMerger) pushAll(heap *datastructures.Heap[commons.File]) error {
+	for index := range merger.files {
+		slices.Sort(merger.files[index].Links)
+
+		err := heap.Push(merger.files[index])
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	merger.files = nil
+	merger.positions = nil
+
+	return nil
+}
+
+// linkedPaths lists every other path of the group members, keyed by the
+// member path.
+func (group *duplicateGroup) linkedPaths() map[string][]string {
+	output := make(map[string][]string)
+
+	for index := range group.files {
+		if len(group.files[index].Links) > 0 {
+			output[group.files[index].Name] = group.files[index].Links
+		}
+	}
+
+	return output
+}
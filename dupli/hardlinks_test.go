@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"archive-tools-monorepo/commons"
+	datastructures "archive-tools-monorepo/dataStructures"
+)
+
+func TestHardlinkMerger_FoldsSameInode(t *testing.T) {
+	merger := newHardlinkMerger()
+	merger.add(commons.File{Name: "/b/copy", Size: 4, Device: 1, Inode: 10})
+	merger.add(commons.File{Name: "/c/copy", Size: 4, Device: 1, Inode: 10})
+	merger.add(commons.File{Name: "/a/copy", Size: 4, Device: 1, Inode: 10})
+	merger.add(commons.File{Name: "/a/other", Size: 4, Device: 2, Inode: 10})
+	merger.add(commons.File{Name: "/a/unknown", Size: 4, Device: 0, Inode: 0})
+	merger.add(commons.File{Name: "/b/unknown", Size: 4, Device: 0, Inode: 0})
+
+	heap, err := datastructures.NewHeap(
+		datastructures.WithComapreFn(func(a *commons.File, b *commons.File) bool { return a.Name < b.Name }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = merger.pushAll(heap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if heap.Size() != 4 || merger.linkedPaths != 2 {
+		t.Fatalf("expected 4 files and 2 linked paths, got %d and %d", heap.Size(), merger.linkedPaths)
+	}
+
+	first, err := heap.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Name != "/a/copy" || !reflect.DeepEqual(first.Links, []string{"/b/copy", "/c/copy"}) {
+		t.Errorf("unexpected merged file: %s %v", first.Name, first.Links)
+	}
+}
+
+func TestFileAction_Delete_RemovesEveryLinkOfExtraCopies(t *testing.T) {
+	baseDir := t.TempDir()
+	group := newTestGroup(t, baseDir, "keep", "copy")
+
+	keeperLink := filepath.Join(baseDir, "keep-link")
+	copyLink := filepath.Join(baseDir, "copy-link")
+
+	for link, target := range map[string]string{keeperLink: group.files[0].Name, copyLink: group.files[1].Name} {
+		if err := os.Link(target, link); err != nil {
+			t.Skip("hardlinks not supported:", err)
+		}
+	}
+
+	group.files[0].Links = []string{keeperLink}
+	group.files[1].Links = []string{copyLink}
+
+	action, err := newGroupAction(deleteActionName, newTestConfiguration(keepOldestFile, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, exists := range map[string]bool{
+		group.files[0].Name: true, keeperLink: true, group.files[1].Name: false, copyLink: false,
+	} {
+		_, err = os.Stat(path)
+		if (err == nil) != exists {
+			t.Errorf("%s: expected existing %v, got error %v", path, exists, err)
+		}
+	}
+
+	stats := action.(*fileAction).stats
+	if stats.filesChanged != 2 || stats.reclaimedSize != group.files[1].Size {
+		t.Errorf("expected 2 paths changed and one copy reclaimed, got %+v", stats)
+	}
+}
+
+func TestReport_CSV_ListsAlreadyLinkedPaths(t *testing.T) {
+	dupliCtx := newTestContext(t, map[string]string{})
+	registry := datastructures.Flyweight[string]{}
+
+	hash, err := registry.Instance("aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range []commons.File{
+		{Name: "/a/one", Links: []string{"/a/one-link"}, Size: 4, Hash: hash},
+		{Name: "/b/one", Size: 4, Hash: hash},
+	} {
+		if err = dupliCtx.heap.Push(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := bytes.Buffer{}
+
+	csvOutput, err := newReporter(csvFormat, &output, reportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dupliCtx.Process(csvOutput, &noneAction{}, newScanMetadata([]string{"/"}, commons.SHA1Hash, &dirwalkerStatistics{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "group_id,hash,size,path,root,linked_to\n1,aaaa,4,/a/one,,\n1,aaaa,4,/a/one-link,,/a/one\n1,aaaa,4,/b/one,,\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
+
+func TestHardlinkMerger_SamePathTwiceIsOneFile(t *testing.T) {
+	merger := newHardlinkMerger()
+	merger.add(commons.File{Name: "/a/file", Size: 4, Device: 1, Inode: 10})
+	merger.add(commons.File{Name: "/a/file", Size: 4, Device: 1, Inode: 10})
+
+	if len(merger.files) != 1 || len(merger.files[0].Links) != 0 || merger.linkedPaths != 0 {
+		t.Errorf("expected a single file without links, got %+v", merger.files)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"archive-tools-monorepo/commons"
+)
+
+const cacheCompactionMinimum = 1000
+
+// cacheIdentity names one hash of one file: the file by device and inode, the
+// hash by algorithm and block size, 0 standing for the full content hash.
+type cacheIdentity struct {
+	Algorithm string
+	Device    uint64
+	Inode     uint64
+	BlockSize int64
+}
+
+// cacheRecord is a line of the cache log, its hash is only used while the
+// file size, mtime and ctime still match.
+type cacheRecord struct {
+	Algorithm  string `json:"algorithm"`
+	Hash       string `json:"hash"`
+	Device     uint64 `json:"dev"`
+	Inode      uint64 `json:"ino"`
+	BlockSize  int64  `json:"block"`
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mtime"`
+	ChangeTime int64  `json:"ctime"`
+}
+
+// hashCache keeps the hashes computed by previous runs in an append only
+// NDJSON log, a newer record of the same identity supersedes the older ones.
+// The log is compacted on Close once most of its lines are superseded or
+// belong to files this run never looked up.
+type hashCache struct {
+	file      *os.File
+	writer    *bufio.Writer
+	encoder   *json.Encoder
+	records   map[cacheIdentity]cacheRecord
+	used      map[cacheIdentity]struct{}
+	cachePath string
+	mutex     sync.Mutex
+	logLines  int
+	hits      int
+	misses    int
+}
+
+func (record *cacheRecord) identity() cacheIdentity {
+	return cacheIdentity{
+		Algorithm: record.Algorithm,
+		Device:    record.Device,
+		Inode:     record.Inode,
+		BlockSize: record.BlockSize,
+	}
+}
+
+func newCacheRecord(file *commons.File, algorithm string, blockSize int64, hash string) cacheRecord {
+	return cacheRecord{
+		Algorithm:  algorithm,
+		Hash:       hash,
+		Device:     file.Device,
+		Inode:      file.Inode,
+		BlockSize:  blockSize,
+		Size:       file.Size,
+		ModTime:    file.ModTime.UnixNano(),
+		ChangeTime: file.ChangeTime.UnixNano(),
+	}
+}
+
+// openHashCache loads every readable line of the log, the cache only saves
+// work so broken lines are skipped instead of failing the run.
+func openHashCache(cachePath string) (*hashCache, error) {
+	if cachePath == "" {
+		return nil, fmt.Errorf("%w: cache path is empty", os.ErrInvalid)
+	}
+
+	cache := &hashCache{
+		file:      nil,
+		writer:    nil,
+		encoder:   nil,
+		records:   make(map[cacheIdentity]cacheRecord),
+		used:      make(map[cacheIdentity]struct{}),
+		cachePath: cachePath,
+		mutex:     sync.Mutex{},
+		logLines:  0,
+		hits:      0,
+		misses:    0,
+	}
+
+	err := cache.load()
+	if err != nil {
+		return nil, err
+	}
+
+	cache.file, err = os.OpenFile(cachePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening hash cache: %w", err)
+	}
+
+	cache.writer = bufio.NewWriter(cache.file)
+	cache.encoder = json.NewEncoder(cache.writer)
+
+	return cache, nil
+}
+
+func (cache *hashCache) load() error {
+	file, err := os.Open(cache.cachePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("error while opening hash cache: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		cache.logLines++
+
+		record := cacheRecord{}
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			continue
+		}
+
+		cache.records[record.identity()] = record
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("error while reading hash cache: %w", err)
+	}
+
+	return nil
+}
+
+// lookup returns the cached hash of file, files without an inode number are
+// never cached since they can't be told apart across runs.
+func (cache *hashCache) lookup(file *commons.File, algorithm string, blockSize int64) (string, bool) {
+	if cache == nil || file.Inode == 0 {
+		return "", false
+	}
+
+	expected := newCacheRecord(file, algorithm, blockSize, "")
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.used[expected.identity()] = struct{}{}
+
+	record, found := cache.records[expected.identity()]
+	expected.Hash = record.Hash
+
+	if !found || record != expected {
+		cache.misses++
+		return "", false
+	}
+
+	cache.hits++
+
+	return record.Hash, true
+}
+
+func (cache *hashCache) store(file *commons.File, algorithm string, blockSize int64, hash string) error {
+	if cache == nil || file.Inode == 0 {
+		return nil
+	}
+
+	record := newCacheRecord(file, algorithm, blockSize, hash)
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.records[record.identity()] = record
+	cache.used[record.identity()] = struct{}{}
+	cache.logLines++
+
+	err := cache.encoder.Encode(record)
+	if err != nil {
+		return fmt.Errorf("error while writing hash cache: %w", err)
+	}
+
+	return nil
+}
+
+func (cache *hashCache) Close() error {
+	if cache == nil {
+		return nil
+	}
+
+	err := cache.writer.Flush()
+	if err != nil {
+		return fmt.Errorf("error while writing hash cache: %w", err)
+	}
+
+	err = cache.file.Close()
+	if err != nil {
+		return fmt.Errorf("error while closing hash cache: %w", err)
+	}
+
+	for identity := range cache.records {
+		if _, used := cache.used[identity]; !used {
+			delete(cache.records, identity)
+		}
+	}
+
+	if cache.logLines > cacheCompactionMinimum && cache.logLines > 2*len(cache.records) {
+		return cache.compact()
+	}
+
+	return nil
+}
+
+// compact rewrites the log with the latest record of every identity used by
+// this run, the new log replaces the old one with a rename so an interrupted
+// compaction never loses the cache.
+func (cache *hashCache) compact() error {
+	compacted, err := os.CreateTemp(filepath.Dir(cache.cachePath), filepath.Base(cache.cachePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error while compacting hash cache: %w", err)
+	}
+
+	writer := bufio.NewWriter(compacted)
+	encoder := json.NewEncoder(writer)
+
+	for _, record := range cache.records {
+		err = encoder.Encode(record)
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	err = errors.Join(err, compacted.Close())
+	if err == nil {
+		err = os.Rename(compacted.Name(), cache.cachePath)
+	}
+
+	if err != nil {
+		_ = os.Remove(compacted.Name())
+		return fmt.Errorf("error while compacting hash cache: %w", err)
+	}
+
+	cache.logLines = len(cache.records)
+
+	return nil
+}
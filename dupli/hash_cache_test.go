@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"archive-tools-monorepo/commons"
+)
+
+func newCachedTestFile(modTime time.Time) commons.File {
+	return commons.File{Name: "/cached", Size: 10, ModTime: modTime, ChangeTime: modTime, Device: 1, Inode: 42}
+}
+
+func TestHashCache_Lookup_SurvivesReopen(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "hashes.cache")
+	file := newCachedTestFile(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	cache, err := openHashCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cache.store(&file, commons.SHA1Hash, 0, "full")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cache.store(&file, commons.SHA1Hash, 4096, "partial")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cache.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err = openHashCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cache.Close() }()
+
+	for blockSize, expected := range map[int64]string{0: "full", 4096: "partial"} {
+		hash, found := cache.lookup(&file, commons.SHA1Hash, blockSize)
+		if !found || hash != expected {
+			t.Errorf("block %d: expected %s, got %s (found %v)", blockSize, expected, hash, found)
+		}
+	}
+
+	_, found := cache.lookup(&file, commons.SHA256Hash, 0)
+	if found {
+		t.Error("expected no hash for another algorithm")
+	}
+}
+
+func TestHashCache_Lookup_ChangedFileMisses(t *testing.T) {
+	cache, err := openHashCache(filepath.Join(t.TempDir(), "hashes.cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cache.Close() }()
+
+	file := newCachedTestFile(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	err = cache.store(&file, commons.SHA1Hash, 0, "full")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file.ChangeTime = file.ChangeTime.Add(time.Second)
+
+	_, found := cache.lookup(&file, commons.SHA1Hash, 0)
+	if found {
+		t.Error("expected a miss after the ctime changed")
+	}
+}
+
+func TestHashCache_Close_CompactsSupersededRecords(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "hashes.cache")
+
+	cache, err := openHashCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range cacheCompactionMinimum + 1 {
+		file := newCachedTestFile(time.Unix(int64(index), 0))
+
+		err = cache.store(&file, commons.SHA1Hash, 0, "full")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = cache.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("expected 1 line after compaction, got %d", lines)
+	}
+}
+
+func TestHashCache_Close_DropsRecordsNotUsedByTheRun(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "hashes.cache")
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cache, err := openHashCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range cacheCompactionMinimum + 1 {
+		file := newCachedTestFile(modTime)
+		file.Inode = uint64(index + 1)
+
+		err = cache.store(&file, commons.SHA1Hash, 0, "full")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = cache.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err = openHashCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := newCachedTestFile(modTime)
+
+	_, found := cache.lookup(&file, commons.SHA1Hash, 0)
+	if !found {
+		t.Fatal("expected the looked up record to be cached")
+	}
+
+	err = cache.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(string(data), "\n"); lines != 1 {
+		t.Errorf("expected only the looked up record after compaction, got %d lines", lines)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"archive-tools-monorepo/commons"
+)
+
+const (
+	defaultBlockSizeKiB  = 16
+	minBlockSizeKiB      = 4
+	maxBlockSizeKiB      = 64
+	defaultPartialStages = 1
+	maxPartialStages     = 8
+)
+
+// hashStage computes the key splitting the files left by the previous stage.
+// Partial stages only read the first and last blockSize bytes, a blockSize of
+// 0 hashes the whole file. Files not larger than reusedUpTo were read whole
+// by an earlier stage, so their current key already is the full hash.
+type hashStage struct {
+	name       string
+	blockSize  int64
+	reusedUpTo int64
+}
+
+// newHashStages returns the partial stages, each one reading blocks twice as
+// large as the previous up to maxBlockSizeKiB, followed by the full hash
+// stage. Stages that would read the largest blocks again are left out.
+func newHashStages(blockSizeKiB int, partialStages int) ([]hashStage, error) {
+	if blockSizeKiB < minBlockSizeKiB || blockSizeKiB > maxBlockSizeKiB {
+		return nil, fmt.Errorf(
+			"%w: block size must be between %d and %d KiB", os.ErrInvalid, minBlockSizeKiB, maxBlockSizeKiB,
+		)
+	}
+
+	if partialStages < 0 || partialStages > maxPartialStages {
+		return nil, fmt.Errorf("%w: partial stages must be between 0 and %d", os.ErrInvalid, maxPartialStages)
+	}
+
+	stages := make([]hashStage, 0, partialStages+1)
+	blockSize := int64(blockSizeKiB) * 1024
+	reusedUpTo := int64(0)
+
+	for range partialStages {
+		stages = append(stages, hashStage{
+			name:       fmt.Sprintf("head/tail %d KiB", blockSize/1024),
+			blockSize:  blockSize,
+			reusedUpTo: reusedUpTo,
+		})
+
+		reusedUpTo = 2 * blockSize
+
+		if blockSize == maxBlockSizeKiB*1024 {
+			break
+		}
+
+		blockSize = min(blockSize*2, maxBlockSizeKiB*1024)
+	}
+
+	return append(stages, hashStage{name: "full hash", blockSize: 0, reusedUpTo: reusedUpTo}), nil
+}
+
+// hash looks the key up in cache before reading the file, cache can be nil.
+func (stage *hashStage) hash(hasher commons.Hasher, cache *hashCache, file *commons.File) (string, error) {
+	var hash string
+	var err error
+
+	if stage.reusedUpTo > 0 && file.Size <= stage.reusedUpTo {
+		return file.Hash.Value(), nil
+	}
+
+	hash, found := cache.lookup(file, hasher.Name(), stage.blockSize)
+	if found {
+		return hash, nil
+	}
+
+	if stage.blockSize == 0 {
+		hash, err = hasher.HashFromPath(file.Name)
+	} else {
+		hash, err = hasher.HashHeadTailFromPath(file.Name, stage.blockSize)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("%w", err)
+	}
+
+	return hash, cache.store(file, hasher.Name(), stage.blockSize, hash)
+}
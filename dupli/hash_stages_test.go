@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"archive-tools-monorepo/commons"
+	datastructures "archive-tools-monorepo/dataStructures"
+)
+
+func TestHashStages_NewHashStages_DoublingBlocks(t *testing.T) {
+	stages, err := newHashStages(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []hashStage{
+		{name: "head/tail 4 KiB", blockSize: 4096, reusedUpTo: 0},
+		{name: "head/tail 8 KiB", blockSize: 8192, reusedUpTo: 8192},
+		{name: "full hash", blockSize: 0, reusedUpTo: 16384},
+	}
+
+	if len(stages) != len(expected) {
+		t.Fatalf("expected %d stages, got %d", len(expected), len(stages))
+	}
+
+	for index := range expected {
+		if stages[index] != expected[index] {
+			t.Errorf("stage %d: expected %+v, got %+v", index, expected[index], stages[index])
+		}
+	}
+}
+
+func TestHashStages_NewHashStages_BlocksCappedAtMaximum(t *testing.T) {
+	for blockSizeKiB, expected := range map[int][]int64{
+		maxBlockSizeKiB: {maxBlockSizeKiB * 1024, 0},
+		48:              {48 * 1024, maxBlockSizeKiB * 1024, 0},
+	} {
+		stages, err := newHashStages(blockSizeKiB, maxPartialStages)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blockSizes := make([]int64, 0, len(stages))
+		for _, stage := range stages {
+			blockSizes = append(blockSizes, stage.blockSize)
+		}
+
+		if !slices.Equal(blockSizes, expected) {
+			t.Errorf("block size %d KiB: expected blocks %v, got %v", blockSizeKiB, expected, blockSizes)
+		}
+	}
+}
+
+func TestHashStages_NewHashStages_InvalidBlockSize(t *testing.T) {
+	for _, blockSize := range []int{2, 128} {
+		_, err := newHashStages(blockSize, 1)
+		if !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("block size %d: expected invalid argument error, got %v", blockSize, err)
+		}
+	}
+}
+
+func TestHashStages_FilterHeap_OnlyFullyEqualFilesGrouped(t *testing.T) {
+	baseDir := t.TempDir()
+	large := make([]byte, 64*1024)
+	middleChanged := make([]byte, 64*1024)
+	middleChanged[32*1024] = 1
+
+	contents := map[string][]byte{
+		"first":         []byte("hello\n"),
+		"second":        []byte("hello\n"),
+		"other":         []byte("world\n"),
+		"large":         large,
+		"large-copy":    large,
+		"middleChanged": middleChanged,
+	}
+
+	registry := datastructures.Flyweight[string]{}
+	hasher, err := commons.NewHasher(commons.XXH64Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dupliCtx, err := newDupliContext(
+		WithNewHeap(commons.StrongFileCompare),
+		WithExistingRegistry(&registry),
+		WithHasher(hasher),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emptyHash, err := registry.Instance("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range contents {
+		fullPath := filepath.Join(baseDir, name)
+
+		err = os.WriteFile(fullPath, data, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = dupliCtx.heap.Push(commons.File{Name: fullPath, Size: int64(len(data)), Hash: emptyHash})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stages, err := newHashStages(4, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range stages {
+		dupliCtx, err = dupliCtx.filterHeap(commons.StrongFileEquality, &registry, &stages[index])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups, err := dupliCtx.collectGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+
+	for _, group := range groups {
+		if len(group.files) != 2 {
+			t.Errorf("expected 2 files in group, got %v", group.paths())
+		}
+
+		for _, path := range group.paths() {
+			if filepath.Base(path) == "middleChanged" || filepath.Base(path) == "other" {
+				t.Errorf("unexpected file %s in group", path)
+			}
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+
+	"archive-tools-monorepo/commons"
+)
+
+const (
+	decisionSkip = iota
+	decisionKeep
+	decisionDelete
+	decisionLink
+)
+
+const (
+	keyArrowUp   rune = -1
+	keyArrowDown rune = -2
+	escapeKey         = 0x1b
+	reviewPage        = 15
+)
+
+var decisionLabels = [...]string{"skip  ", "keep  ", "delete", "link  "}
+
+var errNoTerminal = errors.New("input is not a terminal")
+
+// reviewSession holds the reviewer decisions, one per file of every group,
+// and the position of the cursor. It knows nothing about the terminal so
+// that the key handling can be exercised on its own.
+type reviewSession struct {
+	groups    []duplicateGroup
+	decisions [][]int
+	group     int
+	cursor    int
+	finished  bool
+}
+
+type reviewPlan struct {
+	deletes        []duplicateGroup
+	links          []duplicateGroup
+	skippedGroups  int
+	reclaimedBytes int64
+}
+
+func newReviewSession(groups []duplicateGroup, policy keepPolicy) *reviewSession {
+	decisions := make([][]int, len(groups))
+
+	for index := range groups {
+		decisions[index] = make([]int, len(groups[index].files))
+
+		keeper, err := policy(groups[index].files)
+		if err == nil {
+			decisions[index][keeper] = decisionKeep
+		}
+	}
+
+	return &reviewSession{
+		groups:    groups,
+		decisions: decisions,
+		group:     0,
+		cursor:    0,
+		finished:  len(groups) == 0,
+	}
+}
+
+func (session *reviewSession) moveToGroup(group int) {
+	if group < 0 || group >= len(session.groups) {
+		return
+	}
+
+	session.group = group
+	session.cursor = 0
+}
+
+func (session *reviewSession) handleKey(key rune) {
+	filesCount := len(session.groups[session.group].files)
+	decisions := session.decisions[session.group]
+
+	switch key {
+	case keyArrowUp:
+		session.cursor = (session.cursor + filesCount - 1) % filesCount
+	case keyArrowDown, '\t':
+		session.cursor = (session.cursor + 1) % filesCount
+	case 'k':
+		decisions[session.cursor] = decisionKeep
+	case 'd':
+		decisions[session.cursor] = decisionDelete
+	case 'l':
+		decisions[session.cursor] = decisionLink
+	case 's':
+		decisions[session.cursor] = decisionSkip
+	case 'n', ' ':
+		if session.group == len(session.groups)-1 {
+			session.finished = true
+		}
+
+		session.moveToGroup(session.group + 1)
+	case 'b':
+		session.moveToGroup(session.group - 1)
+	case 'q':
+		session.finished = true
+	}
+}
+
+func countDecisions(decisions []int, decision int) int {
+	count := 0
+
+	for _, current := range decisions {
+		if current == decision {
+			count++
+		}
+	}
+
+	return count
+}
+
+// plan turns the decisions into groups whose first file is the kept one,
+// groups asking for changes without keeping any file are left out.
+func (session *reviewSession) plan() reviewPlan {
+	output := reviewPlan{
+		deletes:        make([]duplicateGroup, 0),
+		links:          make([]duplicateGroup, 0),
+		skippedGroups:  0,
+		reclaimedBytes: 0,
+	}
+
+	for index := range session.groups {
+		group := &session.groups[index]
+		decisions := session.decisions[index]
+
+		keeper := -1
+		for position, decision := range decisions {
+			if decision == decisionKeep {
+				keeper = position
+				break
+			}
+		}
+
+		changes := countDecisions(decisions, decisionDelete) + countDecisions(decisions, decisionLink)
+
+		if changes == 0 {
+			continue
+		}
+
+		if keeper == -1 {
+			output.skippedGroups++
+			continue
+		}
+
+		for _, decision := range []int{decisionDelete, decisionLink} {
+			if countDecisions(decisions, decision) == 0 {
+				continue
+			}
+
+			planned := duplicateGroup{
+				hash:  group.hash,
+				size:  group.size,
+				id:    group.id,
+				files: []commons.File{group.files[keeper]},
+			}
+
+			for position := range group.files {
+				if decisions[position] == decision {
+					planned.files = append(planned.files, group.files[position])
+				}
+			}
+
+			if decision == decisionDelete {
+				output.deletes = append(output.deletes, planned)
+			} else {
+				output.links = append(output.links, planned)
+			}
+		}
+
+		output.reclaimedBytes += group.size * int64(changes)
+	}
+
+	return output
+}
+
+func keepFirstFile(files []commons.File) (int, error) {
+	if len(files) == 0 {
+		return -1, errNoKeeper
+	}
+
+	return 0, nil
+}
+
+// apply runs the planned changes through the delete and hardlink actions,
+// so they get the same safety checks and journal entries.
+func (plan *reviewPlan) apply(configuration actionConfiguration) error {
+	configuration.policy = keepFirstFile
+
+	for _, step := range []struct {
+		groups     []duplicateGroup
+		actionName string
+	}{
+		{groups: plan.deletes, actionName: deleteActionName},
+		{groups: plan.links, actionName: hardlinkActionName},
+	} {
+		if len(step.groups) == 0 {
+			continue
+		}
+
+		action, err := newGroupAction(step.actionName, configuration)
+		if err != nil {
+			return err
+		}
+
+		for index := range step.groups {
+			err = action.Apply(&step.groups[index])
+			if err != nil {
+				return fmt.Errorf("%w", err)
+			}
+		}
+
+		err = action.Close()
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+	}
+
+	return nil
+}
+
+// readKey returns the next keystroke, an escape sequence is only read when
+// its bytes arrived with the escape key so a lone escape never waits for the
+// following keys. Unknown sequences are consumed and returned as 0.
+func readKey(reader *bufio.Reader) (rune, error) {
+	key, err := reader.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+
+	if key != escapeKey {
+		return rune(key), nil
+	}
+
+	if reader.Buffered() == 0 {
+		return escapeKey, nil
+	}
+
+	next, err := reader.Peek(1)
+	if err != nil || next[0] != '[' {
+		return escapeKey, nil
+	}
+
+	sequence := make([]byte, 0, 4)
+
+	for reader.Buffered() > 0 {
+		key, err = reader.ReadByte()
+		if err != nil {
+			return 0, fmt.Errorf("%w", err)
+		}
+
+		sequence = append(sequence, key)
+
+		if len(sequence) > 1 && key >= '@' && key <= '~' {
+			break
+		}
+	}
+
+	switch string(sequence) {
+	case "[A":
+		return keyArrowUp, nil
+	case "[B":
+		return keyArrowDown, nil
+	default:
+		return 0, nil
+	}
+}
+
+func readConfirmation(reader *bufio.Reader) bool {
+	for {
+		key, err := readKey(reader)
+		if err != nil {
+			return false
+		}
+
+		if key != '\n' && key != '\r' {
+			return key == 'y' || key == 'Y'
+		}
+	}
+}
+
+func addReviewScreen() {
+	ui.AddNewNamedLine("review-header", "%s")
+
+	for index := range reviewPage {
+		ui.AddNewNamedLine(fmt.Sprintf("review-file-%d", index), "%s")
+	}
+
+	ui.AddNewNamedLine("review-status", "%s")
+	ui.AddNewNamedLine("review-help", "%s")
+}
+
+func formatReviewFile(file *commons.File, decision int, selected bool) string {
+	marker := " "
+	if selected {
+		marker = ">"
+	}
+
+	formattedSize, err := commons.FormatFileSize(file.Size)
+	if err != nil {
+		return fmt.Sprintf("%s [%s] %s", marker, decisionLabels[decision], file.Name)
+	}
+
+	return fmt.Sprintf(
+		"%s [%s] %4d %2s  %s  %s",
+		marker, decisionLabels[decision], formattedSize.Value, *formattedSize.Unit,
+		file.ModTime.Format("2006-01-02 15:04"), file.Name,
+	)
+}
+
+func renderReviewScreen(session *reviewSession) {
+	group := &session.groups[session.group]
+	decisions := session.decisions[session.group]
+
+	ui.SetNamedLine("review-header", fmt.Sprintf(
+		"Group %d/%d: %d files, hash %s", session.group+1, len(session.groups), len(group.files), group.hash,
+	))
+
+	firstVisible := max(0, min(session.cursor-reviewPage/2, len(group.files)-reviewPage))
+
+	for index := range reviewPage {
+		line := ""
+		position := firstVisible + index
+
+		if position < len(group.files) {
+			line = formatReviewFile(&group.files[position], decisions[position], position == session.cursor)
+		}
+
+		ui.SetNamedLine(fmt.Sprintf("review-file-%d", index), line)
+	}
+
+	status := fmt.Sprintf(
+		"%d kept, %d to delete, %d to link", countDecisions(decisions, decisionKeep),
+		countDecisions(decisions, decisionDelete), countDecisions(decisions, decisionLink),
+	)
+
+	if countDecisions(decisions, decisionKeep) == 0 && len(decisions) != countDecisions(decisions, decisionSkip) {
+		status += " - no file kept, this group will not be changed"
+	}
+
+	ui.SetNamedLine("review-status", status)
+	ui.SetNamedLine("review-help", "up/down move  k keep  d delete  l link  s skip  n next  b back  q finish")
+}
+
+// runInteractiveReview pages through the groups reading single keystrokes
+// from input, then asks for confirmation before applying the decisions.
+func runInteractiveReview(groups []duplicateGroup, configuration actionConfiguration, input *os.File) error {
+	restoreTerminal, err := enableKeystrokeMode(input.Fd())
+	if err != nil {
+		restoreTerminal = func() error { return nil }
+	}
+
+	reader := bufio.NewReader(input)
+	session := newReviewSession(groups, configuration.policy)
+
+	if !session.finished {
+		addReviewScreen()
+	}
+
+	for !session.finished {
+		renderReviewScreen(session)
+
+		key, err := readKey(reader)
+		if err != nil {
+			break
+		}
+
+		session.handleKey(key)
+	}
+
+	plan := session.plan()
+
+	formattedSize, err := commons.FormatFileSize(plan.reclaimedBytes)
+	if err != nil {
+		return errors.Join(err, restoreTerminal())
+	}
+
+	ui.Println(
+		"%d groups to delete from, %d groups to link, %d %s to reclaim, %d groups without kept file ignored",
+		len(plan.deletes), len(plan.links), formattedSize.Value, *formattedSize.Unit, plan.skippedGroups,
+	)
+
+	if len(plan.deletes) == 0 && len(plan.links) == 0 {
+		return restoreTerminal()
+	}
+
+	ui.Println("Apply these changes? [y/N]")
+	confirmed := readConfirmation(reader)
+
+	err = restoreTerminal()
+	if err != nil {
+		return fmt.Errorf("error while restoring terminal: %w", err)
+	}
+
+	if !confirmed {
+		ui.Println("No changes applied")
+		return nil
+	}
+
+	return plan.apply(configuration)
+}
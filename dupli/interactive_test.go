@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReviewSession_KeystrokesBuildPlan(t *testing.T) {
+	first := newTestGroup(t, t.TempDir(), "a/file", "b/file", "c/file")
+	second := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+	second.id = 2
+
+	session := newReviewSession([]duplicateGroup{*first, *second}, keepOldestFile)
+
+	for _, key := range []rune{keyArrowDown, 'd', keyArrowDown, 'l', 'n', 's', 'q'} {
+		session.handleKey(key)
+	}
+
+	if !session.finished {
+		t.Error("expected review to be finished")
+	}
+
+	plan := session.plan()
+
+	if len(plan.deletes) != 1 || len(plan.deletes[0].files) != 2 || plan.deletes[0].files[1].Name != first.files[1].Name {
+		t.Errorf("unexpected deletes: %+v", plan.deletes)
+	}
+
+	if len(plan.links) != 1 || plan.links[0].files[0].Name != first.files[0].Name {
+		t.Errorf("unexpected links: %+v", plan.links)
+	}
+
+	if plan.reclaimedBytes != 14 {
+		t.Errorf("expected 14 bytes to reclaim, got %d", plan.reclaimedBytes)
+	}
+}
+
+func TestReviewSession_NoKeptFile_GroupIgnored(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+	session := newReviewSession([]duplicateGroup{*group}, keepOldestFile)
+
+	for _, key := range []rune{'d', keyArrowDown, 'd', 'n'} {
+		session.handleKey(key)
+	}
+
+	plan := session.plan()
+
+	if len(plan.deletes) != 0 || plan.skippedGroups != 1 {
+		t.Errorf("expected group without kept file to be ignored, got %+v", plan)
+	}
+}
+
+func TestInteractiveReview_AppliesAfterConfirmation(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = writer.WriteString("\x1b[Bdny")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runInteractiveReview([]duplicateGroup{*group}, newTestConfiguration(keepOldestFile, false), reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(group.files[1].Name)
+	if err == nil {
+		t.Error("confirmed delete was not applied")
+	}
+
+	_, err = os.Stat(group.files[0].Name)
+	if err != nil {
+		t.Error("kept file was removed")
+	}
+}
+
+func TestOutputPipeline_InteractiveDryRun_Error(t *testing.T) {
+	options := defaultOutputOptions()
+	options.interactive = true
+
+	_, err := newOutputPipeline(options, 0)
+	if !errors.Is(err, os.ErrInvalid) {
+		t.Errorf("expected invalid argument error, got %v", err)
+	}
+}
+
+func TestInteractiveReview_Declined_NoJournal(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+	journalPath := filepath.Join(t.TempDir(), "changes.journal")
+
+	changesJournal, err := newJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = writer.WriteString("\x1b[Bdnn")
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configuration := newTestConfiguration(keepOldestFile, false)
+	configuration.journal = changesJournal
+
+	err = runInteractiveReview([]duplicateGroup{*group}, configuration, reader)
+	if err == nil {
+		err = changesJournal.Close()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(journalPath)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no journal when nothing is applied, got %v", err)
+	}
+
+	_, err = os.Stat(group.files[1].Name)
+	if err != nil {
+		t.Error("declined delete was applied")
+	}
+}
+
+func TestReadKey_LoneEscapeDoesNotSwallowNextKeys(t *testing.T) {
+	reader := bufio.NewReader(io.MultiReader(
+		strings.NewReader("\x1b"),
+		strings.NewReader("q"),
+		strings.NewReader("\x1b[Bd\x1b[Cy"),
+	))
+
+	expected := []rune{escapeKey, 'q', keyArrowDown, 'd', 0, 'y'}
+
+	for _, want := range expected {
+		key, err := readKey(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if key != want {
+			t.Errorf("expected key %d, got %d", want, key)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"archive-tools-monorepo/commons"
+)
+
+const (
+	journalPending = "pending"
+	journalDone    = "done"
+	journalFailed  = "failed"
+)
+
+type fileMetadata struct {
+	ModTime time.Time   `json:"mtime"`
+	Mode    fs.FileMode `json:"mode"`
+	Size    int64       `json:"size"`
+	UID     uint32      `json:"uid"`
+	GID     uint32      `json:"gid"`
+}
+
+// journalEntry is written twice for every change: once as pending before the
+// change is made and once as done or failed afterwards, both lines share the
+// same run and id.
+type journalEntry struct {
+	Time      time.Time    `json:"time"`
+	Run       string       `json:"run"`
+	ID        int          `json:"id"`
+	State     string       `json:"state"`
+	Operation string       `json:"operation"`
+	Source    string       `json:"source"`
+	Target    string       `json:"target"`
+	SHA1      string       `json:"sha1"`
+	Error     string       `json:"error,omitempty"`
+	Metadata  fileMetadata `json:"metadata"`
+}
+
+// journal is an append only NDJSON log of the changes made on disk, every
+// entry is synced before returning so an interrupted run still leaves a
+// usable record behind. The file is only created with the first entry, so a
+// run that changes nothing leaves no journal.
+type journal struct {
+	file    *os.File
+	encoder *json.Encoder
+	path    string
+	run     string
+	mutex   sync.Mutex
+	lastID  int
+}
+
+func getDefaultJournalPath() string {
+	return "dupli-" + time.Now().UTC().Format("20060102T150405Z") + ".journal"
+}
+
+func newJournal(journalPath string) (*journal, error) {
+	if journalPath == "" {
+		return nil, fmt.Errorf("%w: journal path is empty", os.ErrInvalid)
+	}
+
+	return &journal{
+		file:    nil,
+		encoder: nil,
+		path:    journalPath,
+		run:     strconv.FormatInt(time.Now().UnixNano(), 36),
+		mutex:   sync.Mutex{},
+		lastID:  0,
+	}, nil
+}
+
+func (j *journal) open() error {
+	if j.file != nil {
+		return nil
+	}
+
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error while opening journal: %w", err)
+	}
+
+	j.file = file
+	j.encoder = json.NewEncoder(file)
+
+	return nil
+}
+
+func getFileMetadata(info fs.FileInfo) fileMetadata {
+	stats := commons.Stats{FileInfo: info}
+	uid, gid, _ := stats.Owner()
+
+	return fileMetadata{
+		ModTime: info.ModTime(),
+		Mode:    info.Mode(),
+		Size:    info.Size(),
+		UID:     uid,
+		GID:     gid,
+	}
+}
+
+// absoluteJournalPaths resolves the recorded paths, so undo and restore don't
+// depend on the directory they are run from.
+func absoluteJournalPaths(source string, target string) (string, string, error) {
+	absoluteSource, err := filepath.Abs(source)
+	if err != nil {
+		return "", "", fmt.Errorf("error while resolving journal path: %w", err)
+	}
+
+	absoluteTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", "", fmt.Errorf("error while resolving journal path: %w", err)
+	}
+
+	return absoluteSource, absoluteTarget, nil
+}
+
+// newJournalEntry captures the state of the file at changedPath before the
+// operation touches it.
+func newJournalEntry(operation string, source string, target string, changedPath string) (journalEntry, error) {
+	info, err := os.Lstat(changedPath)
+	if err != nil {
+		return journalEntry{}, fmt.Errorf("error while reading metadata: %w", err)
+	}
+
+	hash, err := commons.GetSHA1HashFromPath(changedPath)
+	if err != nil {
+		return journalEntry{}, fmt.Errorf("%w", err)
+	}
+
+	return journalEntry{
+		Time:      time.Time{},
+		Run:       "",
+		ID:        0,
+		State:     journalPending,
+		Operation: operation,
+		Source:    source,
+		Target:    target,
+		SHA1:      hash,
+		Error:     "",
+		Metadata:  getFileMetadata(info),
+	}, nil
+}
+
+// Begin records entry as pending and returns it with its id assigned.
+func (j *journal) Begin(entry journalEntry) (journalEntry, error) {
+	if j == nil {
+		return entry, nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.lastID++
+	entry.Run = j.run
+	entry.ID = j.lastID
+	entry.State = journalPending
+
+	return entry, j.write(entry)
+}
+
+// Commit records the outcome of an entry previously passed to Begin.
+func (j *journal) Commit(entry journalEntry, operationErr error) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	entry.State = journalDone
+	if operationErr != nil {
+		entry.State = journalFailed
+		entry.Error = operationErr.Error()
+	}
+
+	return j.write(entry)
+}
+
+func (j *journal) write(entry journalEntry) error {
+	err := j.open()
+	if err != nil {
+		return err
+	}
+
+	entry.Time = time.Now().UTC()
+
+	err = j.encoder.Encode(entry)
+	if err != nil {
+		return fmt.Errorf("error while writing journal: %w", err)
+	}
+
+	err = j.file.Sync()
+	if err != nil {
+		return fmt.Errorf("error while writing journal: %w", err)
+	}
+
+	return nil
+}
+
+func (j *journal) Close() error {
+	if j == nil || j.file == nil {
+		return nil
+	}
+
+	err := j.file.Close()
+	if err != nil {
+		return fmt.Errorf("error while closing journal: %w", err)
+	}
+
+	return nil
+}
+
+// readJournal loads every complete line, a truncated last line left by an
+// interrupted run is ignored. Lines sharing run and id are collapsed into
+// their latest state, keeping the order in which changes were started.
+func readJournal(journalPath string) ([]journalEntry, error) {
+	file, err := os.Open(journalPath)
+	if err != nil {
+		return nil, fmt.Errorf("error while opening journal: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	entries := make([]journalEntry, 0)
+	positions := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lastErr error
+
+	for scanner.Scan() {
+		if lastErr != nil {
+			return nil, fmt.Errorf("error while reading journal: %w", lastErr)
+		}
+
+		entry := journalEntry{}
+		lastErr = json.Unmarshal(scanner.Bytes(), &entry)
+		if lastErr != nil {
+			continue
+		}
+
+		key := entry.Run + "/" + strconv.Itoa(entry.ID)
+		position, seen := positions[key]
+
+		if seen {
+			entries[position] = entry
+		} else {
+			positions[key] = len(entries)
+			entries = append(entries, entry)
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error while reading journal: %w", err)
+	}
+
+	return entries, nil
+}
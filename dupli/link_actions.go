@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"archive-tools-monorepo/commons"
+)
+
+// checkSingleDevice vetoes groups spanning more than one filesystem, hard
+// links can't cross a device boundary.
+func checkSingleDevice(group *duplicateGroup, keeper int) error {
+	for index := range group.files {
+		if group.files[index].Device != group.files[keeper].Device {
+			return fmt.Errorf("%w: group %d spans multiple filesystems", os.ErrInvalid, group.id)
+		}
+	}
+
+	return nil
+}
+
+// checkSameMode refuses to replace a copy whose permissions differ from the
+// kept file: linked paths share the mode and timestamps of the kept file, so
+// the copy's own can't be kept. Refused copies are counted as skipped.
+func checkSameMode(keeper *commons.File, extra *commons.File) error {
+	keeperInfo, err := os.Lstat(keeper.Name)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	extraInfo, err := os.Lstat(extra.Name)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	if keeperInfo.Mode().Perm() != extraInfo.Mode().Perm() {
+		return fmt.Errorf(
+			"%w: mode %s differs from kept file mode %s",
+			os.ErrPermission, extraInfo.Mode().Perm(), keeperInfo.Mode().Perm(),
+		)
+	}
+
+	return nil
+}
+
+func getTemporaryPath(target string) string {
+	return filepath.Join(
+		filepath.Dir(target),
+		"."+filepath.Base(target)+".dupli-"+strconv.Itoa(os.Getpid())+".tmp",
+	)
+}
+
+// swapFile creates the replacement next to target through createFn and then
+// renames it over target, so target always points either to the old or to
+// the new content. Timestamps of the parent directory are restored when
+// possible.
+func swapFile(target string, createFn func(temporaryPath string) error) error {
+	directory := filepath.Dir(target)
+	temporaryPath := getTemporaryPath(target)
+
+	directoryInfo, directoryErr := os.Stat(directory)
+
+	err := createFn(temporaryPath)
+	if err != nil {
+		return fmt.Errorf("error while creating replacement: %w", err)
+	}
+
+	err = os.Rename(temporaryPath, target)
+	if err != nil {
+		removeErr := os.Remove(temporaryPath)
+		if removeErr != nil {
+			return fmt.Errorf("error while replacing file: %w (temporary file left: %w)", err, removeErr)
+		}
+
+		return fmt.Errorf("error while replacing file: %w", err)
+	}
+
+	if directoryErr == nil {
+		_ = os.Chtimes(directory, directoryInfo.ModTime(), directoryInfo.ModTime())
+	}
+
+	return nil
+}
+
+func hardlinkExtraCopy(keeper *commons.File, extra *commons.File) error {
+	return swapFile(extra.Name, func(temporaryPath string) error {
+		return os.Link(keeper.Name, temporaryPath)
+	})
+}
+
+func getSymlinkOperation(relative bool) func(*commons.File, *commons.File) error {
+	return func(keeper *commons.File, extra *commons.File) error {
+		target, err := getSymlinkTarget(keeper.Name, extra.Name, relative)
+		if err != nil {
+			return err
+		}
+
+		return swapFile(extra.Name, func(temporaryPath string) error {
+			return os.Symlink(target, temporaryPath)
+		})
+	}
+}
+
+func getSymlinkTarget(keeperPath string, linkPath string, relative bool) (string, error) {
+	absoluteKeeper, err := filepath.Abs(keeperPath)
+	if err != nil {
+		return "", fmt.Errorf("error while resolving symlink target: %w", err)
+	}
+
+	if !relative {
+		return absoluteKeeper, nil
+	}
+
+	absoluteLink, err := filepath.Abs(linkPath)
+	if err != nil {
+		return "", fmt.Errorf("error while resolving symlink target: %w", err)
+	}
+
+	target, err := filepath.Rel(filepath.Dir(absoluteLink), absoluteKeeper)
+	if err != nil {
+		return "", fmt.Errorf("error while resolving symlink target: %w", err)
+	}
+
+	return target, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHardlinkAction_ReplacesExtraCopies(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file", "c/file")
+
+	action, err := newGroupAction(hardlinkActionName, newTestConfiguration(keepOldestFile, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keeperInfo, err := os.Stat(group.files[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range group.files[1:] {
+		info, err := os.Stat(group.files[index+1].Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !os.SameFile(keeperInfo, info) {
+			t.Errorf("%s is not linked to the kept file", group.files[index+1].Name)
+		}
+	}
+}
+
+func TestHardlinkAction_MultipleDevices_SkipsGroup(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+	group.files[1].Device = group.files[0].Device + 1
+
+	action, err := newGroupAction(hardlinkActionName, newTestConfiguration(keepOldestFile, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := os.Stat(group.files[0].Name)
+	second, _ := os.Stat(group.files[1].Name)
+
+	if os.SameFile(first, second) {
+		t.Error("group spanning multiple devices was linked")
+	}
+}
+
+func TestHardlinkAction_DifferentMode_SkipsFile(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+
+	err := os.Chmod(group.files[1].Name, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	action, err := newGroupAction(hardlinkActionName, newTestConfiguration(keepOldestFile, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(group.files[1].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode of skipped file changed to %s", info.Mode().Perm())
+	}
+
+	if stats := action.(*fileAction).stats; stats.filesSkipped != 1 || stats.filesChanged != 0 {
+		t.Errorf("expected the file counted as skipped, got %+v", stats)
+	}
+}
+
+func TestSymlinkAction_RelativeLinks_AreJournaledAndIgnoredOnRescan(t *testing.T) {
+	baseDir := t.TempDir()
+	group := newTestGroup(t, baseDir, "a/file", "b/c/file")
+	journalPath := filepath.Join(t.TempDir(), "changes.journal")
+
+	changesJournal, err := newJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configuration := newTestConfiguration(keepOldestFile, false)
+	configuration.relativeSymlinks = true
+	configuration.journal = changesJournal
+
+	action, err := newGroupAction(symlinkActionName, configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = changesJournal.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := os.Readlink(group.files[1].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if target != filepath.Join("..", "..", "a", "file") {
+		t.Errorf("unexpected relative target %s", target)
+	}
+
+	content, err := os.ReadFile(group.files[1].Name)
+	if err != nil || string(content) != "content" {
+		t.Errorf("symlink does not resolve to the kept file: %v", err)
+	}
+
+	entries, err := readJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("expected one journal entry, got %d", len(entries))
+	}
+
+	entry := entries[0]
+	if entry.Operation != "symlink" || entry.State != journalDone ||
+		entry.Source != group.files[0].Name || entry.Target != group.files[1].Name {
+		t.Errorf("unexpected journal entry: %+v", entry)
+	}
+
+	walker := NewWalker(false)
+	walker.SetEntryPoint(baseDir)
+	walker.SetDirectoryFilter(func(_ string) bool { return true })
+	walker.SetDirectoryCallback(func() {})
+
+	processedFiles := []FilesystemObject{}
+	walker.SetFileCallback(func(info FilesystemObject) {
+		processedFiles = append(processedFiles, info)
+	})
+
+	walker.Walk()
+
+	if len(processedFiles) != 1 || processedFiles[0].path != group.files[0].Name {
+		t.Errorf("expected only the kept file on rescan, got %v", processedFiles)
+	}
+}
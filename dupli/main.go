@@ -2,9 +2,13 @@ package main
 
 import (
 	_ "embed"
+	"errors"
 	"flag"
+	"fmt"
+	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"archive-tools-monorepo/commons"
 	datastructures "archive-tools-monorepo/dataStructures"
@@ -38,96 +42,604 @@ func filter[T comparable](input []T, filterValue T) []T {
 func processOutputChannelData(
 	outputChannel chan commons.File,
 	outputWg *sync.WaitGroup,
-	container *datastructures.Heap[commons.File],
+	merger *hardlinkMerger,
 ) {
-	var err error
 	for data := range outputChannel {
-		err = container.Push(data)
-		if err != nil {
-			panic(err)
-		}
+		merger.add(data)
 	}
 	outputWg.Done()
 }
 
-func main() {
-	startDirectory := ""
-	ignoredDirUser := ""
-	skipEmpty := false
-	profile := false
-	profiler := commons.Profiler{}
+func getActionLogger(format string) func(string, ...any) {
+	if format == textFormat {
+		return ui.Println
+	}
 
-	var fileProcessorPool *commons.WriteOnlyThreadPool[FilesystemObject]
+	return func(format string, a ...any) {
+		fmt.Fprintf(os.Stderr, format+"\n", a...)
+	}
+}
 
-	sharedRegistry := datastructures.Flyweight[string]{}
-	outputFileHeap, err := newDupliContext(
-		WithNewHeap(commons.StrongFileCompare),
-		WithExistingRegistry(&sharedRegistry),
-	)
+func runRestore(arguments []string) {
+	restoreFlags := flag.NewFlagSet("restore", flag.ExitOnError)
+	restoreFlags.Usage = func() {
+		fmt.Fprintf(restoreFlags.Output(), "Usage: %s restore JOURNAL\n", os.Args[0])
+		restoreFlags.PrintDefaults()
+	}
+
+	err := restoreFlags.Parse(arguments)
 	if err != nil {
 		panic(err)
 	}
 
-	outputChannel := make(chan commons.File)
-	outputWg := sync.WaitGroup{}
+	if restoreFlags.NArg() != 1 {
+		restoreFlags.Usage()
+		os.Exit(2)
+	}
 
-	flag.StringVar(&startDirectory, "dir", "", "Scan starting point  directory")
-	flag.StringVar(&ignoredDirUser, "skip_dirs", "", "Skip user defined directories during scan (separated by comma)")
-	flag.BoolVar(&skipEmpty, "no_empty", false, "Skip empty files during scan")
-	flag.BoolVar(&profile, "profile", false, "Profile program performances")
+	err = restoreFromJournal(restoreFlags.Arg(0), getActionLogger(textFormat))
+	if err != nil {
+		panic(err)
+	}
+}
 
-	flag.Parse()
+func runUndo(arguments []string) {
+	undoFlags := flag.NewFlagSet("undo", flag.ExitOnError)
+	undoFlags.Usage = func() {
+		fmt.Fprintf(undoFlags.Output(), "Usage: %s undo JOURNAL\n", os.Args[0])
+		undoFlags.PrintDefaults()
+	}
 
-	if profile {
-		ui.ToggleSilence()
-		profiler.Start()
+	err := undoFlags.Parse(arguments)
+	if err != nil {
+		panic(err)
 	}
 
-	userDirectories := filter(strings.Split(ignoredDirUser, ","), "")
+	if undoFlags.NArg() != 1 {
+		undoFlags.Usage()
+		os.Exit(2)
+	}
 
-	ui.Println("%s", logo)
-	ui.Println("Running version: %s", version)
-	ui.Println("Build timestamp: %s", buildts)
+	err = undoJournal(undoFlags.Arg(0), nil, getActionLogger(textFormat))
+	if err != nil {
+		panic(err)
+	}
+}
 
-	if outputFileHeap == nil {
-		panic("error wile creating new file heap object")
+func reviewGroups(dupliCtx *DupliContext, configuration actionConfiguration, verify bool) error {
+	var groups []duplicateGroup
+	var mismatches []duplicateGroup
+	var err error
+
+	if verify {
+		groups, mismatches, _, err = dupliCtx.collectVerifiedGroups(configuration.logFn)
+	} else {
+		groups, err = dupliCtx.collectGroups()
 	}
 
-	workerFn, err := getFileProcessWorker(outputFileHeap.hashRegistry, outputChannel, &outputFileHeap.sizeFilter)
+	if err != nil {
+		return err
+	}
+
+	if len(mismatches) > 0 {
+		ui.Println("%d groups share a hash but differ in content, they are left out", len(mismatches))
+	}
+
+	return runInteractiveReview(groups, configuration, os.Stdin)
+}
+
+// scanSession holds the heap filled by the walk and what is needed to hash
+// the files found.
+type scanSession struct {
+	dupliCtx *DupliContext
+	registry *datastructures.Flyweight[string]
+	hasher   commons.Hasher
+	cache    *hashCache
+	stats    dirwalkerStatistics
+}
+
+func openScan(options scanOptions) (*scanSession, error) {
+	var cache *hashCache
+
+	hasher, err := commons.NewHasher(options.hashAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	if options.cachePath != "" {
+		cache, err = openHashCache(options.cachePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	registry := &datastructures.Flyweight[string]{}
+	dupliCtx, err := newDupliContext(
+		WithNewHeap(commons.StrongFileCompare),
+		WithExistingRegistry(registry),
+		WithHasher(hasher),
+		WithHashCache(cache),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scanSession{
+		dupliCtx: dupliCtx,
+		registry: registry,
+		hasher:   hasher,
+		cache:    cache,
+		stats:    dirwalkerStatistics{},
+	}, nil
+}
+
+// walk fills the heap with every file below the roots.
+func (scan *scanSession) walk(options scanOptions, roots []string) {
+	outputChannel := make(chan commons.File)
+	outputWg := sync.WaitGroup{}
+	filters, err := options.filters.build(time.Now())
 	if err != nil {
 		panic(err)
 	}
 
-	fileProcessorPool, err = commons.NewWorkerPool(workerFn)
+	skippedDevices, err := options.skippedDevices()
 	if err != nil {
 		panic(err)
 	}
 
-	walker := NewWalker(skipEmpty)
+	workerFn, err := getFileProcessWorker(scan.dupliCtx.hashRegistry, outputChannel)
+	if err != nil {
+		panic(err)
+	}
+
+	fileProcessorPool, err := commons.NewWorkerPool(workerFn)
+	if err != nil {
+		panic(err)
+	}
+
+	walker := NewWalker(filters.skipEmpty)
 
 	if walker == nil {
 		panic("error wile creating new file walker object")
 	}
 
+	err = walker.SetOrder(options.order)
+	if err != nil {
+		panic(err)
+	}
+
 	outputWg.Add(1)
 
-	go processOutputChannelData(outputChannel, &outputWg, outputFileHeap.heap)
+	merger := newHardlinkMerger()
 
-	walker.SetEntryPoint(startDirectory)
-	walker.SetDirectoryFilter(getDirectoryFilter(&userDirectories))
+	go processOutputChannelData(outputChannel, &outputWg, merger)
+
+	for _, root := range roots {
+		walker.SetEntryPoint(root)
+	}
+	walker.SetDirectoryFilter(getDirectoryFilter(&filters.ignoredDirectories))
+	walker.SetPathFilter(filters.rules)
+	walker.SetCandidateFilter(filters.candidates)
+	walker.SetFollowSymlinks(options.followSymlinks)
+	walker.SetOneFilesystem(options.oneFilesystem)
+	walker.SetSkippedDevices(skippedDevices)
 	walker.SetFileCallback(getFileCallback(fileProcessorPool))
-	walker.SetDirectoryCallback(fileProcessorPool.Wait)
+	walker.SetReaders(options.readers)
+	walker.SetMaxDepth(options.maxDepth)
 
 	walker.Walk()
 
+	for _, link := range walker.stats.danglingLinks {
+		ui.Println("Dangling symlink: %s", link)
+	}
+
+	for _, ignoreError := range walker.stats.ignoreFileErrors {
+		ui.Println("Ignore file left out, the rules of the parent directories apply: %s", ignoreError)
+	}
+
+	if walker.stats.skippedMounts > 0 {
+		ui.Println("Skipped %d mount points of other or excluded filesystems", walker.stats.skippedMounts)
+	}
+
+	if walker.stats.overlappingDirectories > 0 {
+		ui.Println("Skipped %d directories already reached through another root", walker.stats.overlappingDirectories)
+	}
+
 	fileProcessorPool.Release()
 
 	close(outputChannel)
 
 	outputWg.Wait()
 
-	cleanedHeap := outputFileHeap.filterHeap(commons.StrongFileEquality, &sharedRegistry)
-	err = cleanedHeap.Display()
+	err = merger.pushAll(scan.dupliCtx.heap)
+	if err != nil {
+		panic(err)
+	}
+
+	if merger.linkedPaths > 0 {
+		ui.Println("Found %d paths already linked to another scanned file", merger.linkedPaths)
+	}
+
+	scan.stats = walker.stats
+	scan.stats.linkedPaths = merger.linkedPaths
+}
+
+func (scan *scanSession) closeCache() error {
+	if scan.cache != nil {
+		ui.Println("Hash cache: %d hits, %d misses", scan.cache.hits, scan.cache.misses)
+	}
+
+	return scan.cache.Close()
+}
+
+// outputPipeline holds what is needed to report and act on the groups, it is
+// built before scanning so that invalid options fail early.
+type outputPipeline struct {
+	output        reporter
+	action        groupAction
+	configuration actionConfiguration
+	options       outputOptions
+}
+
+func newOutputPipeline(options outputOptions, hashWidth int) (*outputPipeline, error) {
+	var changesJournal *journal
+
+	options.report.hashWidth = hashWidth
+
+	output, err := newReporter(options.format, os.Stdout, options.report)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.interactive && options.format != textFormat {
+		return nil, fmt.Errorf("%w: interactive review needs the text format", os.ErrInvalid)
+	}
+
+	references := options.references()
+
+	if options.interactive && options.dryRun {
+		return nil, fmt.Errorf("%w: interactive review applies the confirmed changes, add -dry-run=false", os.ErrInvalid)
+	}
+
+	if options.interactive && len(references) > 0 {
+		return nil, fmt.Errorf("%w: interactive review can't be used with reference directories", os.ErrInvalid)
+	}
+
+	policy, err := newKeepPolicy(options.keepPolicyName, filter(strings.Split(options.preferredDirectories, ","), ""))
+	if err != nil {
+		return nil, err
+	}
+
+	if (options.actionName != noneActionName || options.interactive) && !options.dryRun {
+		if options.journalPath == "" {
+			options.journalPath = getDefaultJournalPath()
+		}
+
+		changesJournal, err = newJournal(options.journalPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	configuration := actionConfiguration{
+		policy:              policy,
+		logFn:               getActionLogger(options.format),
+		journal:             changesJournal,
+		quarantineDirectory: options.quarantineDirectory,
+		dryRun:              options.dryRun,
+		relativeSymlinks:    options.relativeSymlinks,
+	}
+
+	var action groupAction
+
+	if len(references) > 0 {
+		output = newReferenceReporter(output, references)
+		action, err = newReferenceAction(options.actionName, configuration, references)
+	} else {
+		action, err = newGroupAction(options.actionName, configuration)
+	}
+
+	if err != nil {
+		return nil, errors.Join(err, changesJournal.Close())
+	}
+
+	return &outputPipeline{
+		output:        output,
+		action:        action,
+		configuration: configuration,
+		options:       options,
+	}, nil
+}
+
+func (pipeline *outputPipeline) run(dupliCtx *DupliContext, metadata scanMetadata) error {
+	var err error
+
+	switch {
+	case pipeline.options.interactive:
+		err = reviewGroups(dupliCtx, pipeline.configuration, pipeline.options.verify)
+	case pipeline.options.verify:
+		err = dupliCtx.ProcessVerified(pipeline.output, pipeline.action, metadata, pipeline.configuration.logFn)
+	default:
+		err = dupliCtx.Process(pipeline.output, pipeline.action, metadata)
+	}
+
+	return errors.Join(err, pipeline.configuration.journal.Close())
+}
+
+func printBanner() {
+	ui.Println("%s", logo)
+	ui.Println("Running version: %s", version)
+	ui.Println("Build timestamp: %s", buildts)
+}
+
+func runScan(arguments []string) {
+	options := defaultScanOptions()
+	snapshotPath := ""
+
+	scanFlags := flag.NewFlagSet("scan", flag.ExitOnError)
+	scanFlags.Usage = func() {
+		fmt.Fprintf(scanFlags.Output(), "Usage: %s scan -save SNAPSHOT [options] ROOT...\n", os.Args[0])
+		scanFlags.PrintDefaults()
+	}
+
+	addScanFlags(scanFlags, &options)
+	scanFlags.StringVar(&snapshotPath, "save", "", "Snapshot file receiving every scanned file and its hash")
+
+	err := scanFlags.Parse(arguments)
+	if err != nil {
+		panic(err)
+	}
+
+	roots := options.roots(scanFlags.Args())
+
+	if snapshotPath == "" || len(roots) == 0 {
+		scanFlags.Usage()
+		os.Exit(2)
+	}
+
+	scan, err := openScan(options)
+	if err != nil {
+		panic(err)
+	}
+
+	printBanner()
+	scan.walk(options, roots)
+
+	snapshot, err := createSnapshot(snapshotPath, newScanMetadata(roots, scan.hasher.Name(), &scan.stats))
+	if err != nil {
+		panic(err)
+	}
+
+	fullHash := hashStage{name: "full hash", blockSize: 0, reusedUpTo: 0}
+
+	err = scan.dupliCtx.hashAllFiles(&fullHash, snapshot.Write, getActionLogger(textFormat))
+	if err == nil {
+		err = snapshot.Close()
+	} else {
+		err = errors.Join(err, snapshot.discard())
+	}
+
+	err = errors.Join(err, scan.closeCache())
+
+	ui.Close()
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func runAnalyze(arguments []string) {
+	filters := defaultFilterOptions()
+	options := defaultOutputOptions()
+
+	analyzeFlags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	analyzeFlags.Usage = func() {
+		fmt.Fprintf(analyzeFlags.Output(), "Usage: %s analyze [options] SNAPSHOT\n", os.Args[0])
+		analyzeFlags.PrintDefaults()
+	}
+
+	addFilterFlags(analyzeFlags, &filters)
+	addOutputFlags(analyzeFlags, &options)
+
+	err := analyzeFlags.Parse(arguments)
+	if err != nil {
+		panic(err)
+	}
+
+	if analyzeFlags.NArg() != 1 {
+		analyzeFlags.Usage()
+		os.Exit(2)
+	}
+
+	registry := datastructures.Flyweight[string]{}
+	dupliCtx, err := newDupliContext(
+		WithNewHeap(commons.StrongFileCompare),
+		WithExistingRegistry(&registry),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	fileFilters, err := filters.build(time.Now())
+	if err != nil {
+		panic(err)
+	}
+
+	merger := newHardlinkMerger()
+
+	header, err := loadSnapshot(analyzeFlags.Arg(0), &registry, func(file commons.File) error {
+		if fileFilters.allows(&file) {
+			merger.add(file)
+		}
+
+		return nil
+	})
+	if err == nil {
+		err = merger.pushAll(dupliCtx.heap)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+
+	hasher, err := commons.NewHasher(header.Scan.HashAlgorithm)
+	if err != nil {
+		panic(err)
+	}
+
+	pipeline, err := newOutputPipeline(options, hasher.Width())
+	if err != nil {
+		panic(err)
+	}
+
+	if options.format != textFormat {
+		ui.ToggleSilence()
+	}
+
+	err = pipeline.run(dupliCtx, header.Scan)
+
+	ui.Close()
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func runCompare(arguments []string) {
+	format := textFormat
+	summaryOnly := false
+
+	compareFlags := flag.NewFlagSet("compare", flag.ExitOnError)
+	compareFlags.Usage = func() {
+		fmt.Fprintf(compareFlags.Output(), "Usage: %s compare [options] SNAPSHOT SNAPSHOT...\n", os.Args[0])
+		compareFlags.PrintDefaults()
+	}
+
+	compareFlags.StringVar(&format, "format", textFormat, "Comparison format: text or json")
+	compareFlags.BoolVar(&summaryOnly, "summary", false, "Only print the per snapshot statistics")
+
+	err := compareFlags.Parse(arguments)
+	if err != nil {
+		panic(err)
+	}
+
+	if compareFlags.NArg() < 2 || (format != textFormat && format != jsonFormat) {
+		compareFlags.Usage()
+		os.Exit(2)
+	}
+
+	registry := datastructures.Flyweight[string]{}
+
+	comparison, err := compareSnapshots(compareFlags.Args(), &registry)
+	if err != nil {
+		panic(err)
+	}
+
+	if format == jsonFormat {
+		ui.ToggleSilence()
+		err = comparison.writeJSON(os.Stdout, summaryOnly)
+	} else {
+		err = comparison.writeText(summaryOnly)
+	}
+
+	ui.Close()
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "undo":
+			runUndo(os.Args[2:])
+			return
+		case "scan":
+			runScan(os.Args[2:])
+			return
+		case "analyze":
+			runAnalyze(os.Args[2:])
+			return
+		case "compare":
+			runCompare(os.Args[2:])
+			return
+		}
+	}
+
+	scanSettings := defaultScanOptions()
+	outputSettings := defaultOutputOptions()
+	profile := false
+	profiler := commons.Profiler{}
+
+	addScanFlags(flag.CommandLine, &scanSettings)
+	addStagesFlags(flag.CommandLine, &scanSettings)
+	flag.BoolVar(&profile, "profile", false, "Profile program performances")
+	addOutputFlags(flag.CommandLine, &outputSettings)
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] ROOT...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	roots := scanSettings.roots(flag.Args())
+	if len(roots) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	roots = append(roots, outputSettings.references()...)
+
+	if outputSettings.interactive && profile {
+		panic("interactive review can't be profiled")
+	}
+
+	stages, err := newHashStages(scanSettings.blockSizeKiB, scanSettings.partialStages)
+	if err != nil {
+		panic(err)
+	}
+
+	scan, err := openScan(scanSettings)
+	if err != nil {
+		panic(err)
+	}
+
+	pipeline, err := newOutputPipeline(outputSettings, scan.hasher.Width())
+	if err != nil {
+		panic(err)
+	}
+
+	if profile || outputSettings.format != textFormat {
+		ui.ToggleSilence()
+	}
+
+	if profile {
+		profiler.Start()
+	}
+
+	printBanner()
+	scan.walk(scanSettings, roots)
+
+	// every stage only hashes the files sharing size and key with another
+	cleanedHeap := scan.dupliCtx
+	for index := range stages {
+		cleanedHeap, err = cleanedHeap.filterHeap(commons.StrongFileEquality, scan.registry, &stages[index])
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	err = scan.closeCache()
+	if err != nil {
+		panic(err)
+	}
+
+	err = pipeline.run(cleanedHeap, newScanMetadata(roots, scan.hasher.Name(), &scan.stats))
 
 	ui.Close()
 
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"archive-tools-monorepo/commons"
+)
+
+// filterOptions select the files taking part in the search, they apply both
+// while scanning and while analyzing a snapshot.
+type filterOptions struct {
+	ignoredDirectories string
+	excludePatterns    string
+	includePatterns    string
+	minSize            string
+	maxSize            string
+	newerThan          string
+	olderThan          string
+	extensions         string
+	skipEmpty          bool
+	ignoreFiles        bool
+}
+
+// fileFilters are the filterOptions ready to be applied.
+type fileFilters struct {
+	ignoredDirectories []string
+	rules              *pathFilter
+	candidates         *candidateFilter
+	skipEmpty          bool
+}
+
+// defaultSkippedFilesystems are pseudo filesystems holding no user data, and
+// tmpfs so that /run and /dev/shm are left out of a scan of /.
+const defaultSkippedFilesystems = "proc,sysfs,devtmpfs,devpts,tmpfs,cgroup,cgroup2,securityfs,debugfs,tracefs,pstore,bpf,mqueue,hugetlbfs,configfs,fusectl,binfmt_misc,efivarfs"
+
+type scanOptions struct {
+	filters            filterOptions
+	startDirectory     string
+	hashAlgorithm      string
+	cachePath          string
+	skippedFilesystems string
+	order              string
+	blockSizeKiB       int
+	partialStages      int
+	readers            int
+	maxDepth           int
+	followSymlinks     bool
+	oneFilesystem      bool
+}
+
+// outputOptions describe what happens to the duplicate groups once found.
+type outputOptions struct {
+	format               string
+	actionName           string
+	keepPolicyName       string
+	preferredDirectories string
+	journalPath          string
+	quarantineDirectory  string
+	referenceDirectories string
+	report               reportOptions
+	dryRun               bool
+	relativeSymlinks     bool
+	interactive          bool
+	verify               bool
+}
+
+func defaultScanOptions() scanOptions {
+	return scanOptions{
+		filters:            defaultFilterOptions(),
+		startDirectory:     "",
+		hashAlgorithm:      commons.SHA1Hash,
+		cachePath:          "",
+		skippedFilesystems: defaultSkippedFilesystems,
+		order:              breadthFirstOrder,
+		blockSizeKiB:       defaultBlockSizeKiB,
+		partialStages:      defaultPartialStages,
+		readers:            defaultWalkerReaders,
+		maxDepth:           unlimitedDepth,
+		followSymlinks:     false,
+		oneFilesystem:      false,
+	}
+}
+
+func defaultFilterOptions() filterOptions {
+	return filterOptions{
+		ignoredDirectories: "",
+		excludePatterns:    "",
+		includePatterns:    "",
+		minSize:            "",
+		maxSize:            "",
+		newerThan:          "",
+		olderThan:          "",
+		extensions:         "",
+		skipEmpty:          false,
+		ignoreFiles:        false,
+	}
+}
+
+func defaultOutputOptions() outputOptions {
+	return outputOptions{
+		format:               textFormat,
+		actionName:           noneActionName,
+		keepPolicyName:       keepOldest,
+		preferredDirectories: "",
+		journalPath:          "",
+		quarantineDirectory:  "",
+		referenceDirectories: "",
+		report:               reportOptions{hashWidth: 0, showSize: false, summarize: false},
+		dryRun:               true,
+		relativeSymlinks:     false,
+		interactive:          false,
+		verify:               false,
+	}
+}
+
+func addFilterFlags(flags *flag.FlagSet, options *filterOptions) {
+	flags.StringVar(&options.ignoredDirectories, "skip_dirs", options.ignoredDirectories, "Skip user defined directories during scan (separated by comma)")
+	flags.BoolVar(&options.skipEmpty, "no_empty", options.skipEmpty, "Skip empty files during scan")
+	flags.StringVar(&options.excludePatterns, "exclude", options.excludePatterns, "Glob patterns of files and directories to skip, relative to the root (separated by comma, ** matches any directories)")
+	flags.StringVar(&options.minSize, "min-size", options.minSize, "Skip files smaller than this size (10M counts in 1000s, 10MiB in 1024s)")
+	flags.StringVar(&options.maxSize, "max-size", options.maxSize, "Skip files larger than this size")
+	flags.StringVar(&options.newerThan, "newer-than", options.newerThan, "Only consider files modified after a date (2006-01-02) or within an age (36h, 30d, 2w, 1y)")
+	flags.StringVar(&options.olderThan, "older-than", options.olderThan, "Only consider files modified before a date or longer ago than an age")
+	flags.StringVar(&options.extensions, "ext", options.extensions, "Extensions to consider (separated by comma), extensions starting with ! are skipped")
+	flags.StringVar(&options.includePatterns, "include", options.includePatterns, "Glob patterns of the only files to consider, relative to the root (separated by comma)")
+}
+
+func addScanFlags(flags *flag.FlagSet, options *scanOptions) {
+	flags.StringVar(&options.startDirectory, "dir", options.startDirectory, "Scan starting point directory, more roots can follow the options")
+	addFilterFlags(flags, &options.filters)
+	flags.BoolVar(&options.filters.ignoreFiles, "ignore-files", options.filters.ignoreFiles, "Honor the .gitignore and .dupliignore files found while scanning")
+	flags.StringVar(&options.hashAlgorithm, "hash", options.hashAlgorithm, "Hash algorithm: sha1, sha256 or xxh64 (fastest, not cryptographic)")
+	flags.BoolVar(&options.followSymlinks, "follow-symlinks", options.followSymlinks, "Scan the targets of symbolic links, link cycles are broken and dangling links reported")
+	flags.IntVar(&options.readers, "readers", options.readers, "Directories listed at the same time, more helps on fast disks and network shares")
+	flags.StringVar(&options.order, "order", options.order, "Directory traversal order: bfs, or dfs to keep memory low on very wide trees")
+	flags.IntVar(&options.maxDepth, "max-depth", options.maxDepth, "Directory levels scanned below each root, 0 only scans the roots and -1 doesn't limit")
+	flags.BoolVar(&options.oneFilesystem, "xdev", options.oneFilesystem, "Stay on the filesystem of each root, mount points below it are not crossed")
+	flags.StringVar(&options.skippedFilesystems, "skip-fstype", options.skippedFilesystems, "Filesystem types whose mounts below a root are not scanned (separated by comma, read from "+commons.MountInfoPath+"), the filesystem of a root is always scanned")
+	flags.StringVar(&options.cachePath, "cache", options.cachePath, "Hash cache file reused across runs, hashes are refreshed when files change and dropped when a run no longer sees them")
+}
+
+// addStagesFlags is only used where files are hashed in stages, snapshots
+// always hash every file whole.
+func addStagesFlags(flags *flag.FlagSet, options *scanOptions) {
+	flags.IntVar(&options.blockSizeKiB, "block-size", options.blockSizeKiB, "Size in KiB of the first and last blocks read by partial hashing")
+	flags.IntVar(&options.partialStages, "stages", options.partialStages, "Partial hashing stages before the full hash, each doubling the block size")
+}
+
+func addOutputFlags(flags *flag.FlagSet, options *outputOptions) {
+	flags.StringVar(&options.format, "format", options.format, "Report format: text, json, csv, ndjson or fdupes")
+	flags.BoolVar(&options.report.showSize, "S", options.report.showSize, "fdupes format: show size of duplicate files")
+	flags.BoolVar(&options.report.summarize, "m", options.report.summarize, "fdupes format: summarize duplicates information")
+	flags.StringVar(&options.actionName, "action", options.actionName, "Action on duplicates: none, delete, hardlink, symlink, reflink or quarantine (hardlink skips copies whose mode differs from the kept file, whose mode and timestamps linked paths share)")
+	flags.StringVar(&options.keepPolicyName, "keep", options.keepPolicyName, "File kept in each group: oldest, newest, shortest or prefer")
+	flags.StringVar(&options.preferredDirectories, "prefer", options.preferredDirectories, "Directories whose files are kept first (separated by comma)")
+	flags.BoolVar(&options.dryRun, "dry-run", options.dryRun, "Only print what the action would change, use -dry-run=false to apply it")
+	flags.BoolVar(&options.relativeSymlinks, "relative", options.relativeSymlinks, "symlink action: create relative link targets")
+	flags.StringVar(&options.quarantineDirectory, "to", options.quarantineDirectory, "quarantine action: directory receiving the extra copies")
+	flags.StringVar(&options.referenceDirectories, "reference", options.referenceDirectories, "Trusted directories (separated by comma), only other files already present in them are reported and changed")
+	flags.BoolVar(&options.interactive, "interactive", options.interactive, "Review every duplicate group and choose what to keep, delete or link, needs -dry-run=false as confirmed changes are applied")
+	flags.BoolVar(&options.verify, "verify", options.verify, "Compare duplicates byte by byte before reporting or changing them")
+	flags.StringVar(&options.journalPath, "journal", options.journalPath, "Journal file recording every change (default dupli-<timestamp>.journal)")
+}
+
+// roots returns -dir followed by the roots given as arguments, a tree reached
+// from several roots is only scanned once.
+func (options *scanOptions) roots(arguments []string) []string {
+	roots := make([]string, 0, len(arguments)+1)
+
+	if options.startDirectory != "" {
+		roots = append(roots, filepath.Clean(options.startDirectory))
+	}
+
+	for _, argument := range arguments {
+		roots = append(roots, filepath.Clean(argument))
+	}
+
+	return roots
+}
+
+// skippedDevices maps the devices of the mounts of a skipped filesystem type
+// to this type.
+func (options *scanOptions) skippedDevices() (map[uint64]string, error) {
+	devices := make(map[uint64]string)
+
+	types := filter(strings.Split(options.skippedFilesystems, ","), "")
+	if len(types) == 0 {
+		return devices, nil
+	}
+
+	mounts, err := commons.LoadMountPoints()
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	for _, mount := range mounts {
+		if slices.Contains(types, mount.FSType) {
+			devices[mount.Device] = mount.FSType
+		}
+	}
+
+	return devices, nil
+}
+
+func (options *outputOptions) references() []string {
+	return filter(strings.Split(options.referenceDirectories, ","), "")
+}
+
+// build checks the options, ages are counted back from now.
+func (options *filterOptions) build(now time.Time) (*fileFilters, error) {
+	rules, err := newPathFilter(
+		filter(strings.Split(options.excludePatterns, ","), ""),
+		filter(strings.Split(options.includePatterns, ","), ""),
+		options.ignoreFiles,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := newCandidateFilter(options, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileFilters{
+		ignoredDirectories: filter(strings.Split(options.ignoredDirectories, ","), ""),
+		rules:              rules,
+		candidates:         candidates,
+		skipEmpty:          options.skipEmpty,
+	}, nil
+}
+
+// allows tells whether a file loaded from a snapshot passes the filters the
+// walker applies while scanning, ignore files can't be read back.
+func (filters *fileFilters) allows(file *commons.File) bool {
+	if filters.skipEmpty && file.Size == 0 || !filters.candidates.allows(file.Name, file.Size, file.ModTime) {
+		return false
+	}
+
+	directory := filepath.Dir(file.Name)
+
+	return checkIfDirIsAllowed(&directory, &filters.ignoredDirectories) &&
+		filters.rules.allowsPath(relativeToRoot(file.Name, file.Root))
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const anyComponents = "**"
+
+// ignoreFileNames are read in every directory when ignore files are honored,
+// their rules apply to the directory holding them and below.
+var ignoreFileNames = [...]string{".gitignore", ".dupliignore"}
+
+// pathPattern is a gitignore-like glob matched component by component, "**"
+// stands for any number of components. A pattern without slash matches at
+// any depth, otherwise it is anchored to the base directory.
+type pathPattern struct {
+	components    []string
+	negate        bool
+	directoryOnly bool
+}
+
+// pathRules are evaluated like a gitignore file, the last matching rule wins.
+type pathRules struct {
+	patterns []pathPattern
+}
+
+// ignoreRules are the rules of the ignore files of one directory, chained to
+// the ones of its parents. Deeper rules take precedence.
+type ignoreRules struct {
+	parent *ignoreRules
+	rules  pathRules
+	base   string
+}
+
+// pathFilter holds the -exclude and -include rules, matched against paths
+// relative to the scan root. Included patterns only restrict files.
+type pathFilter struct {
+	excludes          pathRules
+	includes          pathRules
+	honorIgnoreFiles  bool
+	hasIncludePattern bool
+}
+
+func compilePattern(pattern string) (pathPattern, error) {
+	compiled := pathPattern{components: nil, negate: false, directoryOnly: false}
+
+	if strings.HasPrefix(pattern, "!") {
+		compiled.negate = true
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		compiled.directoryOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimLeft(pattern, "/")
+
+	if pattern == "" {
+		return compiled, fmt.Errorf("%w: empty path pattern", os.ErrInvalid)
+	}
+
+	compiled.components = strings.Split(pattern, "/")
+	if !anchored {
+		compiled.components = append([]string{anyComponents}, compiled.components...)
+	}
+
+	for _, component := range compiled.components {
+		_, err := path.Match(component, "")
+		if err != nil {
+			return compiled, fmt.Errorf("%w: bad path pattern %s", os.ErrInvalid, pattern)
+		}
+	}
+
+	return compiled, nil
+}
+
+func matchComponents(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == anyComponents {
+			for index := 0; index <= len(name); index++ {
+				if matchComponents(pattern[1:], name[index:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		matched, err := path.Match(pattern[0], name[0])
+		if err != nil || !matched {
+			return false
+		}
+
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// matches tells whether the slash separated relative path matches.
+func (pattern *pathPattern) matches(relative string, isDirectory bool) bool {
+	if pattern.directoryOnly && !isDirectory {
+		return false
+	}
+
+	return matchComponents(pattern.components, strings.Split(relative, "/"))
+}
+
+func newPathRules(patterns []string) (pathRules, error) {
+	rules := pathRules{patterns: make([]pathPattern, 0, len(patterns))}
+
+	for _, pattern := range patterns {
+		compiled, err := compilePattern(pattern)
+		if err != nil {
+			return rules, err
+		}
+
+		rules.patterns = append(rules.patterns, compiled)
+	}
+
+	return rules, nil
+}
+
+// match returns whether a rule matched the path and if it excludes it.
+func (rules *pathRules) match(relative string, isDirectory bool) (bool, bool) {
+	for index := len(rules.patterns) - 1; index >= 0; index-- {
+		if rules.patterns[index].matches(relative, isDirectory) {
+			return true, !rules.patterns[index].negate
+		}
+	}
+
+	return false, false
+}
+
+// loadIgnoreRules reads the ignore files of directory, parent is returned
+// as is when there is none or one can't be read. Lines that aren't valid
+// patterns are skipped.
+func loadIgnoreRules(directory string, parent *ignoreRules) (*ignoreRules, error) {
+	rules := pathRules{patterns: make([]pathPattern, 0)}
+
+	for _, name := range ignoreFileNames {
+		ignorePath := filepath.Join(directory, name)
+
+		file, err := os.Open(ignorePath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return parent, fmt.Errorf("error while reading ignore file %s: %w", ignorePath, err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), " \r\t")
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			compiled, err := compilePattern(strings.TrimPrefix(line, "\\"))
+			if err == nil {
+				rules.patterns = append(rules.patterns, compiled)
+			}
+		}
+
+		err = errors.Join(scanner.Err(), file.Close())
+		if err != nil {
+			return parent, fmt.Errorf("error while reading ignore file %s: %w", ignorePath, err)
+		}
+	}
+
+	if len(rules.patterns) == 0 {
+		return parent, nil
+	}
+
+	return &ignoreRules{parent: parent, rules: rules, base: directory}, nil
+}
+
+func (ignore *ignoreRules) excluded(fullPath string, isDirectory bool) bool {
+	for current := ignore; current != nil; current = current.parent {
+		relative, err := filepath.Rel(current.base, fullPath)
+		if err != nil {
+			continue
+		}
+
+		matched, excluded := current.rules.match(filepath.ToSlash(relative), isDirectory)
+		if matched {
+			return excluded
+		}
+	}
+
+	return false
+}
+
+func newPathFilter(excludes []string, includes []string, honorIgnoreFiles bool) (*pathFilter, error) {
+	excludeRules, err := newPathRules(excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	includeRules, err := newPathRules(includes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pathFilter{
+		excludes:          excludeRules,
+		includes:          includeRules,
+		honorIgnoreFiles:  honorIgnoreFiles,
+		hasIncludePattern: len(includes) > 0,
+	}, nil
+}
+
+func relativeToRoot(fullPath string, root string) string {
+	relative, err := filepath.Rel(root, fullPath)
+	if root == "" || err != nil {
+		relative = strings.TrimLeft(filepath.Clean(fullPath), string(filepath.Separator))
+	}
+
+	return filepath.ToSlash(relative)
+}
+
+func (filter *pathFilter) allowsDirectory(relative string) bool {
+	_, excluded := filter.excludes.match(relative, true)
+	return !excluded
+}
+
+func (filter *pathFilter) allowsFile(relative string) bool {
+	_, excluded := filter.excludes.match(relative, false)
+	if excluded {
+		return false
+	}
+
+	if !filter.hasIncludePattern {
+		return true
+	}
+
+	_, included := filter.includes.match(relative, false)
+
+	return included
+}
+
+// allowsPath checks a file and every directory leading to it, as the walker
+// would have, ignore files excepted.
+func (filter *pathFilter) allowsPath(relative string) bool {
+	components := strings.Split(relative, "/")
+
+	for index := 1; index < len(components); index++ {
+		if !filter.allowsDirectory(strings.Join(components[:index], "/")) {
+			return false
+		}
+	}
+
+	return filter.allowsFile(relative)
+}
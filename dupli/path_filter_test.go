@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"archive-tools-monorepo/commons"
+)
+
+func TestPathPattern_Matches(t *testing.T) {
+	cases := []struct {
+		pattern     string
+		relative    string
+		isDirectory bool
+		expected    bool
+	}{
+		{"tmp", "tmp", true, true},
+		{"tmp", "a/b/tmp", true, true},
+		{"tmp", "tmpfiles", true, false},
+		{"tmp", "attempt", true, false},
+		{"*.log", "a/b/debug.log", false, true},
+		{"*.log", "a/log", false, false},
+		{"build/", "a/build", true, true},
+		{"build/", "a/build", false, false},
+		{"a/b", "a/b", true, true},
+		{"a/b", "x/a/b", true, false},
+		{"/a", "a", false, true},
+		{"/a", "x/a", false, false},
+		{"a/**/z", "a/z", false, true},
+		{"a/**/z", "a/b/c/z", false, true},
+		{"a/**/z", "b/a/z", false, false},
+		{"**/cache/*.bin", "x/y/cache/data.bin", false, true},
+		{"photos/20??", "photos/2024", true, true},
+	}
+
+	for _, current := range cases {
+		pattern, err := compilePattern(current.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pattern.matches(current.relative, current.isDirectory) != current.expected {
+			t.Errorf("%q against %q: expected %v", current.pattern, current.relative, current.expected)
+		}
+	}
+}
+
+func TestPathPattern_InvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{"", "/", "!", "[a"} {
+		_, err := compilePattern(pattern)
+		if !errors.Is(err, os.ErrInvalid) {
+			t.Errorf("pattern %q: expected invalid argument error, got %v", pattern, err)
+		}
+	}
+}
+
+func TestPathFilter_LastRuleWinsAndIncludes(t *testing.T) {
+	filter, err := newPathFilter([]string{"*.tmp", "!keep.tmp"}, []string{"*.jpg", "*.tmp"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]bool{
+		"a/photo.jpg":   true,
+		"a/notes.txt":   false,
+		"a/scratch.tmp": false,
+		"a/keep.tmp":    true,
+	}
+
+	for relative, allowed := range expected {
+		if filter.allowsPath(relative) != allowed {
+			t.Errorf("%s: expected allowed %v", relative, allowed)
+		}
+	}
+}
+
+func TestCheckIfDirIsAllowed_ComponentSemantics(t *testing.T) {
+	blacklist := []string{"tmp", "cache/old", "/data/private"}
+
+	expected := map[string]bool{
+		"/home/user/tmp":           false,
+		"/home/user/tmp/inner":     false,
+		"/home/user/tmpfiles":      true,
+		"/data/attempt":            true,
+		"/srv/cache/old/x":         false,
+		"/srv/cache/older":         true,
+		"/data/private":            false,
+		"/backup/data/private":     true,
+		"/data/private-but-public": true,
+	}
+
+	for fullPath, allowed := range expected {
+		if checkIfDirIsAllowed(&fullPath, &blacklist) != allowed {
+			t.Errorf("%s: expected allowed %v", fullPath, allowed)
+		}
+	}
+}
+
+func TestDirWalker_ExcludeRulesAndIgnoreFiles(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{
+		"keep.txt":               "data",
+		"debug.log":              "data",
+		"node_modules/lib.js":    "data",
+		"src/.gitignore":         "*.o\n# comment\n!main.o\n",
+		"src/main.o":             "data",
+		"src/util.o":             "data",
+		"src/deep/.dupliignore":  "generated/\n",
+		"src/deep/generated/x.c": "data",
+		"src/deep/y.o":           "data",
+	})
+
+	filter, err := newPathFilter([]string{"*.log", "node_modules/"}, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walker := NewWalker(false)
+	walker.SetEntryPoint(baseDir)
+	walker.SetDirectoryFilter(func(_ string) bool {
+		return true
+	})
+	walker.SetPathFilter(filter)
+
+	walked := make(map[string]bool)
+	walker.SetFileCallback(func(info FilesystemObject) {
+		relative, err := filepath.Rel(baseDir, info.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		walked[filepath.ToSlash(relative)] = true
+	})
+	walker.SetDirectoryCallback(func() {})
+	walker.Walk()
+
+	expected := []string{"keep.txt", "src/.gitignore", "src/main.o", "src/deep/.dupliignore"}
+
+	if len(walked) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, walked)
+	}
+
+	for _, name := range expected {
+		if !walked[name] {
+			t.Errorf("expected %s to be walked, got %v", name, walked)
+		}
+	}
+}
+
+func TestDirWalker_UnreadableIgnoreFile_KeepsParentRules(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{
+		".gitignore":          "*.o\n",
+		"src/.gitignore/file": "data",
+		"src/main.o":          "data",
+		"src/main.c":          "data",
+	})
+
+	filter, err := newPathFilter(nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walker := NewWalker(false)
+	walker.SetEntryPoint(baseDir)
+	walker.SetDirectoryFilter(func(_ string) bool {
+		return true
+	})
+	walker.SetPathFilter(filter)
+
+	walked := make(map[string]bool)
+	walker.SetFileCallback(func(info FilesystemObject) {
+		relative, err := filepath.Rel(baseDir, info.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		walked[filepath.ToSlash(relative)] = true
+	})
+	walker.SetDirectoryCallback(func() {})
+	walker.Walk()
+
+	if walked["src/main.o"] || !walked["src/main.c"] {
+		t.Errorf("expected the root rules to apply below src, got %v", walked)
+	}
+
+	if len(walker.stats.ignoreFileErrors) != 1 {
+		t.Errorf("expected the unreadable ignore file to be reported, got %v", walker.stats.ignoreFileErrors)
+	}
+}
+
+func TestFileFilters_Allows_SnapshotFilesRelativeToRoot(t *testing.T) {
+	options := defaultFilterOptions()
+	options.excludePatterns = "/archive,*.bak"
+
+	filters, err := options.build(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]bool{
+		"/data/archive/file": false,
+		"/data/sub/archive":  true,
+		"/data/sub/file.bak": false,
+		"/data/sub/file":     true,
+	}
+
+	for name, allowed := range expected {
+		file := commons.File{Name: name, Root: "/data"}
+		if filters.allows(&file) != allowed {
+			t.Errorf("%s: expected allowed %v", name, allowed)
+		}
+	}
+}
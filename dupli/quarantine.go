@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"archive-tools-monorepo/commons"
+)
+
+func getQuarantinePath(quarantineDirectory string, originalPath string) (string, error) {
+	absolutePath, err := filepath.Abs(originalPath)
+	if err != nil {
+		return "", fmt.Errorf("error while resolving quarantine path: %w", err)
+	}
+
+	return filepath.Join(quarantineDirectory, filepath.VolumeName(absolutePath), absolutePath), nil
+}
+
+func getQuarantineJournalPaths(
+	quarantineDirectory string,
+) func(*commons.File, *commons.File) (string, string, error) {
+	return func(_ *commons.File, extra *commons.File) (string, string, error) {
+		destination, err := getQuarantinePath(quarantineDirectory, extra.Name)
+		return extra.Name, destination, err
+	}
+}
+
+func getQuarantineOperation(quarantineDirectory string) func(*commons.File, *commons.File) error {
+	return func(_ *commons.File, extra *commons.File) error {
+		destination, err := getQuarantinePath(quarantineDirectory, extra.Name)
+		if err != nil {
+			return err
+		}
+
+		return moveFile(extra.Name, destination)
+	}
+}
+
+// moveFile renames source to destination creating the missing parent
+// directories, when the two paths live on different filesystems the file is
+// copied with its mode and timestamps and then removed.
+func moveFile(source string, destination string) error {
+	_, err := os.Lstat(destination)
+	if err == nil {
+		return fmt.Errorf("%w: %s", os.ErrExist, destination)
+	}
+
+	err = os.MkdirAll(filepath.Dir(destination), 0o700)
+	if err != nil {
+		return fmt.Errorf("error while creating destination directory: %w", err)
+	}
+
+	err = os.Rename(source, destination)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, syscall.EXDEV) {
+		return fmt.Errorf("error while moving file: %w", err)
+	}
+
+	err = copyFile(source, destination)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(source)
+	if err != nil {
+		return fmt.Errorf("error while removing moved file: %w", err)
+	}
+
+	return nil
+}
+
+func copyFile(source string, destination string) error {
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	input, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer func() { _ = input.Close() }()
+
+	output, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, sourceInfo.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	_, err = io.Copy(output, input)
+	if err == nil {
+		err = output.Sync()
+	}
+
+	closeErr := output.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(destination)
+		return fmt.Errorf("error while copying file: %w", err)
+	}
+
+	err = os.Chtimes(destination, sourceInfo.ModTime(), sourceInfo.ModTime())
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func changeDirectory(t *testing.T, directory string) {
+	t.Helper()
+
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chdir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = os.Chdir(previous) })
+}
+
+func TestQuarantineAction_MovesAndRestores(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file", "c/file")
+	quarantineDirectory := t.TempDir()
+	journalPath := filepath.Join(t.TempDir(), "changes.journal")
+
+	changesJournal, err := newJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configuration := newTestConfiguration(keepOldestFile, false)
+	configuration.journal = changesJournal
+	configuration.quarantineDirectory = quarantineDirectory
+
+	action, err := newGroupAction(quarantineActionName, configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = changesJournal.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, extra := range group.files[1:] {
+		_, err = os.Stat(extra.Name)
+		if err == nil {
+			t.Errorf("%s was not moved", extra.Name)
+		}
+
+		_, err = os.Stat(filepath.Join(quarantineDirectory, extra.Name))
+		if err != nil {
+			t.Errorf("%s is missing from quarantine: %v", extra.Name, err)
+		}
+	}
+
+	// Simulate a run interrupted while writing the journal.
+	journalFile, err := os.OpenFile(journalPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = journalFile.WriteString(`{"operation":"quarant`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = journalFile.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = restoreFromJournal(journalPath, func(string, ...any) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range group.files {
+		content, err := os.ReadFile(file.Name)
+		if err != nil || string(content) != "content" {
+			t.Errorf("%s was not restored: %v", file.Name, err)
+		}
+	}
+}
+
+func TestQuarantineAction_WithoutDirectory_Error(t *testing.T) {
+	_, err := newGroupAction(quarantineActionName, newTestConfiguration(keepOldestFile, false))
+	if err == nil {
+		t.Error("expected error when quarantine directory is missing")
+	}
+}
+
+func TestQuarantineAction_RelativeRoots_RestoredFromAnyDirectory(t *testing.T) {
+	baseDir := t.TempDir()
+	changeDirectory(t, baseDir)
+
+	group := newTestGroup(t, ".", "a/file", "b/file")
+	quarantineDirectory := "quarantine"
+	journalPath := filepath.Join(baseDir, "changes.journal")
+
+	changesJournal, err := newJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configuration := newTestConfiguration(keepOldestFile, false)
+	configuration.journal = changesJournal
+	configuration.quarantineDirectory = quarantineDirectory
+
+	action, err := newGroupAction(quarantineActionName, configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err == nil {
+		err = changesJournal.Close()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := readJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if !filepath.IsAbs(entry.Source) || !filepath.IsAbs(entry.Target) {
+			t.Errorf("expected absolute journal paths, got %s and %s", entry.Source, entry.Target)
+		}
+	}
+
+	changeDirectory(t, t.TempDir())
+
+	err = restoreFromJournal(journalPath, func(string, ...any) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(baseDir, "b", "file"))
+	if err != nil || string(content) != "content" {
+		t.Errorf("quarantined file was not restored in place: %v", err)
+	}
+}
+
+func TestUndoEntry_RelativePaths_Refused(t *testing.T) {
+	entry := journalEntry{Operation: quarantineActionName, Source: "b/file", Target: "/quarantine/b/file"}
+
+	err := undoEntry(&entry)
+	if !errors.Is(err, errNotReversible) {
+		t.Errorf("expected not reversible error, got %v", err)
+	}
+}
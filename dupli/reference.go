@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"archive-tools-monorepo/commons"
+)
+
+// referenceFilter tells apart the files inside the trusted reference trees,
+// which are never listed nor changed, from the incoming ones. A file inside
+// both a reference and an incoming root, or with a hardlink inside a
+// reference tree, counts as reference.
+type referenceFilter struct {
+	directories []string
+}
+
+// referenceReporter only reports the incoming files of the groups that also
+// have a reference copy, groups are numbered again as some are left out.
+type referenceReporter struct {
+	output reporter
+	filter referenceFilter
+	lastID int
+}
+
+// referenceAction hands the inner action, which keeps the first member, a
+// group made of a reference file selected by policy and the incoming files.
+type referenceAction struct {
+	action groupAction
+	policy keepPolicy
+	filter referenceFilter
+}
+
+func (filter *referenceFilter) split(files []commons.File) ([]commons.File, []commons.File) {
+	references := make([]commons.File, 0)
+	incoming := make([]commons.File, 0)
+
+	for index := range files {
+		isReference := false
+
+		for _, directory := range filter.directories {
+			for _, path := range append([]string{files[index].Name}, files[index].Links...) {
+				isReference = isReference || isInsideDirectory(path, directory)
+			}
+		}
+
+		if isReference {
+			references = append(references, files[index])
+		} else {
+			incoming = append(incoming, files[index])
+		}
+	}
+
+	return references, incoming
+}
+
+func (filter *referenceFilter) incomingGroup(group *duplicateGroup, id int) (duplicateGroup, bool) {
+	references, incoming := filter.split(group.files)
+
+	return duplicateGroup{
+		hash:  group.hash,
+		files: incoming,
+		size:  group.size,
+		id:    id,
+	}, len(references) > 0 && len(incoming) > 0
+}
+
+func newReferenceReporter(output reporter, directories []string) *referenceReporter {
+	return &referenceReporter{output: output, filter: referenceFilter{directories: directories}, lastID: 0}
+}
+
+func (r *referenceReporter) Begin(metadata scanMetadata) error {
+	return r.output.Begin(metadata)
+}
+
+func (r *referenceReporter) Group(group *duplicateGroup) error {
+	incoming, found := r.filter.incomingGroup(group, r.lastID+1)
+	if !found {
+		return nil
+	}
+
+	r.lastID++
+
+	return r.output.Group(&incoming)
+}
+
+// Mismatch hides the reference files as well, mismatches keep their ids.
+func (r *referenceReporter) Mismatch(group *duplicateGroup) error {
+	_, incoming := r.filter.split(group.files)
+	if len(incoming) == 0 {
+		return nil
+	}
+
+	mismatch := *group
+	mismatch.files = incoming
+
+	return r.output.Mismatch(&mismatch)
+}
+
+func (r *referenceReporter) End() error {
+	return r.output.End()
+}
+
+func newReferenceAction(
+	name string,
+	configuration actionConfiguration,
+	directories []string,
+) (*referenceAction, error) {
+	policy := configuration.policy
+	configuration.policy = keepFirstFile
+
+	action, err := newGroupAction(name, configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &referenceAction{action: action, policy: policy, filter: referenceFilter{directories: directories}}, nil
+}
+
+func (action *referenceAction) Apply(group *duplicateGroup) error {
+	references, incoming := action.filter.split(group.files)
+	if len(references) == 0 || len(incoming) == 0 {
+		return nil
+	}
+
+	keeper, err := action.policy(references)
+	if err != nil {
+		// fall back on the first reference file, the policy may only know
+		// about directories of the incoming trees
+		keeper = 0
+	}
+
+	if keeper < 0 || keeper >= len(references) {
+		return fmt.Errorf("%w: group %d keeper index out of range", os.ErrInvalid, group.id)
+	}
+
+	referenced := *group
+	referenced.files = append([]commons.File{references[keeper]}, incoming...)
+
+	return action.action.Apply(&referenced)
+}
+
+func (action *referenceAction) Close() error {
+	return action.action.Close()
+}
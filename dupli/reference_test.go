@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReferenceReporter_ListsOnlyIncomingFilesWithReferenceCopy(t *testing.T) {
+	dupliCtx := newTestContext(t, map[string]string{
+		"/archive/one":   "aaaa",
+		"/incoming/one":  "aaaa",
+		"/incoming/copy": "aaaa",
+		"/incoming/new":  "bbbbbb",
+		"/incoming/new2": "bbbbbb",
+		"/archive/old":   "cccccccc",
+		"/archive/old2":  "cccccccc",
+	})
+
+	var output bytes.Buffer
+	csvOutput, err := newReporter(csvFormat, &output, reportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dupliCtx.Process(
+		newReferenceReporter(csvOutput, []string{"/archive"}), &noneAction{},
+		newScanMetadata([]string{"/"}, "", &dirwalkerStatistics{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "group_id,hash,size,path,root,linked_to\n1,aaaa,4,/incoming/copy,,\n1,aaaa,4,/incoming/one,,\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
+
+func TestReferenceAction_RemovesOnlyIncomingFiles(t *testing.T) {
+	baseDir := t.TempDir()
+	group := newTestGroup(t, baseDir, "incoming/old", "archive/file", "incoming/new")
+
+	action, err := newReferenceAction(
+		deleteActionName, newTestConfiguration(keepOldestFile, false), []string{filepath.Join(baseDir, "archive")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range group.files {
+		_, err = os.Stat(group.files[index].Name)
+		isReference := strings.Contains(group.files[index].Name, "archive")
+
+		if isReference && err != nil {
+			t.Errorf("expected reference %s to be kept, got %v", group.files[index].Name, err)
+		}
+
+		if !isReference && !os.IsNotExist(err) {
+			t.Errorf("expected incoming %s to be removed, got %v", group.files[index].Name, err)
+		}
+	}
+}
+
+func TestReferenceAction_NoReferenceCopy_NothingChanged(t *testing.T) {
+	baseDir := t.TempDir()
+	group := newTestGroup(t, baseDir, "incoming/a", "incoming/b")
+
+	action, err := newReferenceAction(
+		deleteActionName, newTestConfiguration(keepOldestFile, false), []string{filepath.Join(baseDir, "archive")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range group.files {
+		_, err = os.Stat(group.files[index].Name)
+		if err != nil {
+			t.Errorf("expected %s to be kept, got %v", group.files[index].Name, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"archive-tools-monorepo/commons"
+)
+
+// ioctl request numbers from linux/fs.h.
+const (
+	ficloneRequest        = 0x40049409
+	fidedupeRangeRequest  = 0xC0189436
+	dedupeRangeSame       = 0
+	dedupeRangeDiffers    = 1
+	maxDedupeRangeRequest = 16 * 1024 * 1024
+)
+
+type fileDedupeRangeInfo struct {
+	destFd       int64
+	destOffset   uint64
+	bytesDeduped uint64
+	status       int32
+	reserved     uint32
+}
+
+// fileDedupeRange mirrors struct file_dedupe_range with a single destination.
+type fileDedupeRange struct {
+	srcOffset uint64
+	srcLength uint64
+	destCount uint16
+	reserved1 uint16
+	reserved2 uint32
+	info      fileDedupeRangeInfo
+}
+
+// isReflinkUnsupported tells the filesystem can't share extents. EINVAL is
+// not part of it: FIDEDUPERANGE also returns it on supporting filesystems,
+// for example on a range mismatch, and falling back to FICLONE would then
+// replace the copy without the kernel comparing the data.
+func isReflinkUnsupported(err error) bool {
+	return errors.Is(err, syscall.EOPNOTSUPP) ||
+		errors.Is(err, syscall.ENOTTY) ||
+		errors.Is(err, syscall.EXDEV)
+}
+
+// reflinkExtraCopy shares the kept file extents with the extra copy. The
+// kernel compares the data itself through FIDEDUPERANGE, filesystems that
+// can clone but not dedupe fall back to a FICLONE into a temporary file.
+func reflinkExtraCopy(keeper *commons.File, extra *commons.File) error {
+	err := dedupeFile(keeper.Name, extra.Name, extra.Size)
+	if err == nil || !isReflinkUnsupported(err) {
+		return err
+	}
+
+	err = cloneFile(keeper.Name, extra.Name)
+	if err != nil && isReflinkUnsupported(err) {
+		return fmt.Errorf("%w: %w", errReflinkUnsupported, err)
+	}
+
+	return err
+}
+
+func dedupeFile(sourcePath string, targetPath string, size int64) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer func() { _ = source.Close() }()
+
+	target, err := os.OpenFile(targetPath, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer func() { _ = target.Close() }()
+
+	offset := uint64(0)
+	for offset < uint64(size) {
+		request := fileDedupeRange{
+			srcOffset: offset,
+			srcLength: min(uint64(size)-offset, maxDedupeRangeRequest),
+			destCount: 1,
+			reserved1: 0,
+			reserved2: 0,
+			info: fileDedupeRangeInfo{
+				destFd:       int64(target.Fd()),
+				destOffset:   offset,
+				bytesDeduped: 0,
+				status:       0,
+				reserved:     0,
+			},
+		}
+
+		_, _, errno := syscall.Syscall(
+			syscall.SYS_IOCTL, source.Fd(), fidedupeRangeRequest, uintptr(unsafe.Pointer(&request)),
+		)
+
+		switch {
+		case errno != 0:
+			return fmt.Errorf("FIDEDUPERANGE: %w", errno)
+		case request.info.status < 0:
+			return fmt.Errorf("FIDEDUPERANGE: %w", syscall.Errno(-request.info.status))
+		case request.info.status == dedupeRangeDiffers:
+			return fmt.Errorf("%w: %s content differs from %s", os.ErrInvalid, targetPath, sourcePath)
+		case request.info.status != dedupeRangeSame || request.info.bytesDeduped == 0:
+			return fmt.Errorf("%w: FIDEDUPERANGE made no progress", os.ErrInvalid)
+		}
+
+		offset += request.info.bytesDeduped
+	}
+
+	return nil
+}
+
+// cloneFile replaces target with a clone of source, keeping the mode and the
+// timestamps of the original target.
+func cloneFile(sourcePath string, targetPath string) error {
+	targetInfo, err := os.Stat(targetPath)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	defer func() { _ = source.Close() }()
+
+	return swapFile(targetPath, func(temporaryPath string) error {
+		clone, err := os.OpenFile(temporaryPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, targetInfo.Mode().Perm())
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, clone.Fd(), ficloneRequest, source.Fd())
+
+		err = clone.Close()
+		if errno != 0 {
+			_ = os.Remove(temporaryPath)
+			return fmt.Errorf("FICLONE: %w", errno)
+		}
+
+		if err != nil {
+			_ = os.Remove(temporaryPath)
+			return fmt.Errorf("%w", err)
+		}
+
+		return os.Chtimes(temporaryPath, targetInfo.ModTime(), targetInfo.ModTime())
+	})
+}
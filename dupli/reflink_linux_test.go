@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestReflinkAction_UnsupportedFilesystem_FailsPerFile(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+
+	failures := 0
+	configuration := newTestConfiguration(keepOldestFile, false)
+	configuration.logFn = func(format string, _ ...any) {
+		if format == "failed to %s %s: %v" {
+			failures++
+		}
+	}
+
+	action, err := newGroupAction(reflinkActionName, configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(group.files[1].Name)
+	if err != nil || string(content) != "content" {
+		t.Errorf("extra copy damaged by reflink attempt: %v", err)
+	}
+
+	fileAction, ok := action.(*fileAction)
+	if !ok {
+		t.Fatal("reflink action is not a file action")
+	}
+
+	if fileAction.stats.filesChanged+fileAction.stats.filesFailed != 1 {
+		t.Errorf("expected one file to be processed, got %+v", fileAction.stats)
+	}
+
+	if fileAction.stats.filesFailed != failures {
+		t.Errorf("expected every failure to be reported, got %d of %d", failures, fileAction.stats.filesFailed)
+	}
+}
+
+func TestReflinkAction_DifferentContent_Error(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+
+	err := os.WriteFile(group.files[1].Name, []byte("CONTENT"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = reflinkExtraCopy(&group.files[0], &group.files[1])
+	if err == nil {
+		t.Error("expected error when deduplicating different content")
+	}
+
+	content, err := os.ReadFile(group.files[1].Name)
+	if err != nil || string(content) != "CONTENT" {
+		t.Errorf("different file changed by reflink attempt: %v", err)
+	}
+}
+
+func TestIsReflinkUnsupported_InvalidArgumentIsAnError(t *testing.T) {
+	expected := map[syscall.Errno]bool{
+		syscall.EOPNOTSUPP: true,
+		syscall.ENOTTY:     true,
+		syscall.EXDEV:      true,
+		syscall.EINVAL:     false,
+	}
+
+	for errno, unsupported := range expected {
+		if isReflinkUnsupported(fmt.Errorf("FIDEDUPERANGE: %w", errno)) != unsupported {
+			t.Errorf("%v: expected unsupported %v", errno, unsupported)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"archive-tools-monorepo/commons"
+)
+
+func reflinkExtraCopy(_ *commons.File, _ *commons.File) error {
+	return fmt.Errorf("%w: not available on %s", errReflinkUnsupported, runtime.GOOS)
+}
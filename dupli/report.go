@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	textFormat   = "text"
+	jsonFormat   = "json"
+	csvFormat    = "csv"
+	ndjsonFormat = "ndjson"
+	fdupesFormat = "fdupes"
+)
+
+// reporter receives the duplicate groups and then, when the groups were
+// verified byte by byte, the hash groups whose content turned out to differ.
+type reporter interface {
+	Begin(metadata scanMetadata) error
+	Group(group *duplicateGroup) error
+	Mismatch(group *duplicateGroup) error
+	End() error
+}
+
+// reportOptions mirror the fdupes switches that change its output layout:
+// showSize is -S and summarize is -m. hashWidth sizes the text hash column.
+type reportOptions struct {
+	hashWidth int
+	showSize  bool
+	summarize bool
+}
+
+type scanMetadata struct {
+	Version         string   `json:"version"`
+	BuildTimestamp  string   `json:"build_timestamp"`
+	HashAlgorithm   string   `json:"hash_algorithm"`
+	Roots           []string `json:"roots"`
+	SizeProcessed   int64    `json:"size_processed"`
+	FilesSeen       int      `json:"files_seen"`
+	DirectoriesSeen int      `json:"directories_seen"`
+	// OverlappingDirectories counts the directories reached again through
+	// another root and not read twice.
+	OverlappingDirectories int `json:"overlapping_directories"`
+	// LinkedPaths counts the hardlinks of scanned files, listed with them and
+	// left out of reclaimable sizes.
+	LinkedPaths int `json:"linked_paths"`
+	// DanglingLinks are the followed symbolic links without target.
+	DanglingLinks []string `json:"dangling_links,omitempty"`
+	// Unverified are the files -verify couldn't read, left out of the groups.
+	Unverified []unverifiedFile `json:"unverified,omitempty"`
+}
+
+type unverifiedFile struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type jsonGroup struct {
+	ID    int      `json:"id"`
+	Hash  string   `json:"hash"`
+	Size  int64    `json:"size"`
+	Files []string `json:"files"`
+	// Roots holds the scan root of every file, in the order of Files.
+	Roots []string `json:"roots"`
+	// AlreadyLinked maps a file to its other paths, hardlinks of the same
+	// inode sharing its storage.
+	AlreadyLinked map[string][]string `json:"already_linked,omitempty"`
+}
+
+type fileRecord struct {
+	GroupID    int    `json:"group_id,omitempty"`
+	MismatchID int    `json:"mismatch_id,omitempty"`
+	Hash       string `json:"hash"`
+	Size       int64  `json:"size"`
+	Path       string `json:"path"`
+	Root       string `json:"root"`
+	LinkedTo   string `json:"linked_to,omitempty"`
+}
+
+// textReporter only shows the root of each file when several were scanned.
+type textReporter struct {
+	hashWidth int
+	showRoots bool
+}
+
+type jsonReporter struct {
+	writer      *bufio.Writer
+	mismatches  []jsonGroup
+	groupsCount int
+}
+
+type csvReporter struct {
+	writer *csv.Writer
+}
+
+type ndjsonReporter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+type fdupesReporter struct {
+	writer          *bufio.Writer
+	options         reportOptions
+	duplicatesSize  int64
+	duplicatesCount int
+	setsCount       int
+}
+
+func newScanMetadata(roots []string, hashAlgorithm string, stats *dirwalkerStatistics) scanMetadata {
+	return scanMetadata{
+		Version:         strings.TrimSpace(version),
+		BuildTimestamp:  strings.TrimSpace(buildts),
+		HashAlgorithm:   hashAlgorithm,
+		Roots:           roots,
+		SizeProcessed:   stats.sizeProcessed,
+		FilesSeen:       stats.fileSeen,
+		DirectoriesSeen: stats.directoriesSeen,
+
+		OverlappingDirectories: stats.overlappingDirectories,
+		LinkedPaths:            stats.linkedPaths,
+		DanglingLinks:          stats.danglingLinks,
+		Unverified:             nil,
+	}
+}
+
+func newReporter(format string, writer io.Writer, options reportOptions) (reporter, error) {
+	switch format {
+	case textFormat:
+		return &textReporter{hashWidth: options.hashWidth, showRoots: false}, nil
+	case jsonFormat:
+		return &jsonReporter{writer: bufio.NewWriter(writer), mismatches: make([]jsonGroup, 0), groupsCount: 0}, nil
+	case csvFormat:
+		return &csvReporter{writer: csv.NewWriter(writer)}, nil
+	case ndjsonFormat:
+		bufferedWriter := bufio.NewWriter(writer)
+		return &ndjsonReporter{writer: bufferedWriter, encoder: json.NewEncoder(bufferedWriter)}, nil
+	case fdupesFormat:
+		return &fdupesReporter{
+			writer:          bufio.NewWriter(writer),
+			options:         options,
+			duplicatesSize:  0,
+			duplicatesCount: 0,
+			setsCount:       0,
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported report format %s", os.ErrInvalid, format)
+	}
+}
+
+func (group *duplicateGroup) toJSON() jsonGroup {
+	return jsonGroup{
+		ID:    group.id,
+		Hash:  group.hash,
+		Size:  group.size,
+		Files: group.paths(),
+		Roots: group.roots(),
+
+		AlreadyLinked: group.linkedPaths(),
+	}
+}
+
+func (r *textReporter) Begin(metadata scanMetadata) error {
+	r.showRoots = len(metadata.Roots) > 1
+	return nil
+}
+
+func (r *textReporter) printFiles(group *duplicateGroup) error {
+	for index := range group.files {
+		line, err := group.files[index].ToStringWithWidth(r.hashWidth)
+		if err != nil {
+			return fmt.Errorf("error while writing text report: %w", err)
+		}
+
+		if r.showRoots {
+			ui.Println("file: %s (root %s)", line, group.files[index].Root)
+		} else {
+			ui.Println("file: %s", line)
+		}
+
+		for _, link := range group.files[index].Links {
+			ui.Println("      already linked: %s", link)
+		}
+	}
+
+	return nil
+}
+
+func (r *textReporter) Group(group *duplicateGroup) error {
+	if group.id > 1 {
+		ui.Println("")
+	}
+
+	return r.printFiles(group)
+}
+
+func (r *textReporter) Mismatch(group *duplicateGroup) error {
+	ui.Println("")
+	ui.Println("content mismatch, same hash but different bytes:")
+
+	return r.printFiles(group)
+}
+
+func (*textReporter) End() error {
+	return nil
+}
+
+func (r *jsonReporter) Begin(metadata scanMetadata) error {
+	data, err := json.MarshalIndent(metadata, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("error while writing json report: %w", err)
+	}
+
+	_, err = fmt.Fprintf(r.writer, "{\n  \"metadata\": %s,\n  \"groups\": [", data)
+	if err != nil {
+		return fmt.Errorf("error while writing json report: %w", err)
+	}
+
+	return nil
+}
+
+func (r *jsonReporter) Group(group *duplicateGroup) error {
+	data, err := json.MarshalIndent(group.toJSON(), "    ", "  ")
+	if err != nil {
+		return fmt.Errorf("error while writing json report: %w", err)
+	}
+
+	separator := ","
+	if r.groupsCount == 0 {
+		separator = ""
+	}
+
+	_, err = fmt.Fprintf(r.writer, "%s\n    %s", separator, data)
+	if err != nil {
+		return fmt.Errorf("error while writing json report: %w", err)
+	}
+
+	r.groupsCount++
+
+	return r.flush()
+}
+
+// Mismatch is kept until End, mismatches are listed after all the groups.
+func (r *jsonReporter) Mismatch(group *duplicateGroup) error {
+	r.mismatches = append(r.mismatches, group.toJSON())
+	return nil
+}
+
+func (r *jsonReporter) End() error {
+	closing := "]"
+	if r.groupsCount > 0 {
+		closing = "\n  ]"
+	}
+
+	if len(r.mismatches) > 0 {
+		data, err := json.MarshalIndent(r.mismatches, "  ", "  ")
+		if err != nil {
+			return fmt.Errorf("error while writing json report: %w", err)
+		}
+
+		closing += ",\n  \"mismatches\": " + string(data)
+	}
+
+	_, err := r.writer.WriteString(closing + "\n}\n")
+	if err != nil {
+		return fmt.Errorf("error while writing json report: %w", err)
+	}
+
+	return r.flush()
+}
+
+func (r *jsonReporter) flush() error {
+	err := r.writer.Flush()
+	if err != nil {
+		return fmt.Errorf("error while writing json report: %w", err)
+	}
+
+	return nil
+}
+
+func (r *csvReporter) Begin(_ scanMetadata) error {
+	err := r.writer.Write([]string{"group_id", "hash", "size", "path", "root", "linked_to"})
+	if err != nil {
+		return fmt.Errorf("error while writing csv report: %w", err)
+	}
+
+	return nil
+}
+
+// writeRows writes one row per file followed by one row per hardlink, whose
+// linked_to column holds the file path.
+func (r *csvReporter) writeRows(groupID string, group *duplicateGroup) error {
+	size := strconv.FormatInt(group.size, 10)
+
+	for index := range group.files {
+		current := &group.files[index]
+
+		err := r.writer.Write([]string{groupID, group.hash, size, current.Name, current.Root, ""})
+		for _, link := range current.Links {
+			if err == nil {
+				err = r.writer.Write([]string{groupID, group.hash, size, link, current.Root, current.Name})
+			}
+		}
+
+		if err != nil {
+			return fmt.Errorf("error while writing csv report: %w", err)
+		}
+	}
+
+	return r.flush()
+}
+
+func (r *csvReporter) Group(group *duplicateGroup) error {
+	return r.writeRows(strconv.Itoa(group.id), group)
+}
+
+// Mismatch rows use mismatch-<id> as group id, so they can't be taken for
+// a duplicate group.
+func (r *csvReporter) Mismatch(group *duplicateGroup) error {
+	return r.writeRows("mismatch-"+strconv.Itoa(group.id), group)
+}
+
+func (r *csvReporter) End() error {
+	return r.flush()
+}
+
+func (r *csvReporter) flush() error {
+	r.writer.Flush()
+
+	err := r.writer.Error()
+	if err != nil {
+		return fmt.Errorf("error while writing csv report: %w", err)
+	}
+
+	return nil
+}
+
+func (*ndjsonReporter) Begin(_ scanMetadata) error {
+	return nil
+}
+
+// writeRecords writes one record per file and per hardlink, hardlinks name
+// their file in linked_to.
+func (r *ndjsonReporter) writeRecords(groupID int, mismatchID int, group *duplicateGroup) error {
+	for index := range group.files {
+		current := &group.files[index]
+		paths := append([]string{current.Name}, current.Links...)
+
+		for position, path := range paths {
+			record := fileRecord{
+				GroupID:    groupID,
+				MismatchID: mismatchID,
+				Hash:       group.hash,
+				Size:       group.size,
+				Path:       path,
+				Root:       current.Root,
+				LinkedTo:   "",
+			}
+
+			if position > 0 {
+				record.LinkedTo = current.Name
+			}
+
+			err := r.encoder.Encode(record)
+			if err != nil {
+				return fmt.Errorf("error while writing ndjson report: %w", err)
+			}
+		}
+	}
+
+	return r.flush()
+}
+
+func (r *ndjsonReporter) Group(group *duplicateGroup) error {
+	return r.writeRecords(group.id, 0, group)
+}
+
+func (r *ndjsonReporter) Mismatch(group *duplicateGroup) error {
+	return r.writeRecords(0, group.id, group)
+}
+
+func (r *ndjsonReporter) End() error {
+	return r.flush()
+}
+
+func (r *ndjsonReporter) flush() error {
+	err := r.writer.Flush()
+	if err != nil {
+		return fmt.Errorf("error while writing ndjson report: %w", err)
+	}
+
+	return nil
+}
+
+func (*fdupesReporter) Begin(_ scanMetadata) error {
+	return nil
+}
+
+func (r *fdupesReporter) Group(group *duplicateGroup) error {
+	var err error
+
+	r.setsCount++
+	r.duplicatesCount += len(group.files) - 1
+	r.duplicatesSize += group.size * int64(len(group.files)-1)
+
+	if r.options.summarize {
+		return nil
+	}
+
+	if r.options.showSize {
+		unit := "bytes"
+		if group.size == 1 {
+			unit = "byte"
+		}
+
+		_, err = fmt.Fprintf(r.writer, "%d %s each:\n", group.size, unit)
+		if err != nil {
+			return fmt.Errorf("error while writing fdupes report: %w", err)
+		}
+	}
+
+	for index := range group.files {
+		_, err = fmt.Fprintf(r.writer, "%s\n", group.files[index].Name)
+		if err != nil {
+			return fmt.Errorf("error while writing fdupes report: %w", err)
+		}
+	}
+
+	_, err = r.writer.WriteString("\n")
+	if err != nil {
+		return fmt.Errorf("error while writing fdupes report: %w", err)
+	}
+
+	return r.flush()
+}
+
+// Mismatch is not reported, fdupes only lists files whose bytes match.
+func (*fdupesReporter) Mismatch(_ *duplicateGroup) error {
+	return nil
+}
+
+// End prints the fdupes -m summary: the first file of every set is not
+// counted as a duplicate, so sizes only account for the extra copies.
+func (r *fdupesReporter) End() error {
+	var err error
+
+	if !r.options.summarize {
+		return r.flush()
+	}
+
+	size := float64(r.duplicatesSize)
+
+	switch {
+	case r.setsCount == 0:
+		_, err = r.writer.WriteString("No duplicates found.\n\n")
+	case size < 1024.0:
+		_, err = fmt.Fprintf(r.writer, "%d duplicate files (in %d sets), occupying %.0f bytes.\n\n",
+			r.duplicatesCount, r.setsCount, size)
+	case size <= 1000.0*1000.0:
+		_, err = fmt.Fprintf(r.writer, "%d duplicate files (in %d sets), occupying %.1f kilobytes\n\n",
+			r.duplicatesCount, r.setsCount, size/1000.0)
+	default:
+		_, err = fmt.Fprintf(r.writer, "%d duplicate files (in %d sets), occupying %.1f megabytes\n\n",
+			r.duplicatesCount, r.setsCount, size/(1000.0*1000.0))
+	}
+
+	if err != nil {
+		return fmt.Errorf("error while writing fdupes report: %w", err)
+	}
+
+	return r.flush()
+}
+
+func (r *fdupesReporter) flush() error {
+	err := r.writer.Flush()
+	if err != nil {
+		return fmt.Errorf("error while writing fdupes report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"archive-tools-monorepo/commons"
+	datastructures "archive-tools-monorepo/dataStructures"
+)
+
+func newTestContext(t *testing.T, files map[string]string) *DupliContext {
+	t.Helper()
+
+	registry := datastructures.Flyweight[string]{}
+	dupliCtx, err := newDupliContext(
+		WithNewHeap(commons.StrongFileCompare),
+		WithExistingRegistry(&registry),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, hash := range files {
+		hashPointer, err := registry.Instance(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = dupliCtx.heap.Push(commons.File{Name: name, Size: int64(len(hash)), Hash: hashPointer})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dupliCtx
+}
+
+func TestReport_JSON_ListsOnlyDuplicateGroups(t *testing.T) {
+	dupliCtx := newTestContext(t, map[string]string{
+		"/a/one":    "aaaa",
+		"/b/one":    "aaaa",
+		"/a/two":    "bbbbbb",
+		"/b/two":    "bbbbbb",
+		"/c/two":    "bbbbbb",
+		"/a/unique": "cccccccc",
+	})
+
+	stats := dirwalkerStatistics{sizeProcessed: 28, fileSeen: 6, directoriesSeen: 3}
+	output := bytes.Buffer{}
+
+	jsonOutput, err := newReporter(jsonFormat, &output, reportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dupliCtx.Process(jsonOutput, &noneAction{}, newScanMetadata([]string{"/"}, commons.SHA1Hash, &stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := struct {
+		Metadata scanMetadata `json:"metadata"`
+		Groups   []jsonGroup  `json:"groups"`
+	}{}
+
+	err = json.Unmarshal(output.Bytes(), &report)
+	if err != nil {
+		t.Fatalf("invalid json document: %v\n%s", err, output.String())
+	}
+
+	if report.Metadata.FilesSeen != 6 || report.Metadata.Roots[0] != "/" {
+		t.Errorf("unexpected metadata: %+v", report.Metadata)
+	}
+
+	if len(report.Groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(report.Groups))
+	}
+
+	if report.Groups[0].Hash != "aaaa" || report.Groups[0].Size != 4 || len(report.Groups[0].Files) != 2 {
+		t.Errorf("unexpected first group: %+v", report.Groups[0])
+	}
+
+	if report.Groups[1].ID != 2 || report.Groups[1].Hash != "bbbbbb" || len(report.Groups[1].Files) != 3 {
+		t.Errorf("unexpected second group: %+v", report.Groups[1])
+	}
+}
+
+func TestReport_JSON_NoGroupsIsValidDocument(t *testing.T) {
+	dupliCtx := newTestContext(t, map[string]string{"/a/unique": "cccccccc"})
+	output := bytes.Buffer{}
+
+	jsonOutput, err := newReporter(jsonFormat, &output, reportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dupliCtx.Process(jsonOutput, &noneAction{}, newScanMetadata([]string{"/"}, commons.SHA1Hash, &dirwalkerStatistics{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !json.Valid(output.Bytes()) {
+		t.Errorf("invalid json document:\n%s", output.String())
+	}
+}
+
+func TestReport_CSV_OneRowPerFile(t *testing.T) {
+	dupliCtx := newTestContext(t, map[string]string{
+		"/a/one": "aaaa",
+		"/b/one": "aaaa",
+	})
+	output := bytes.Buffer{}
+
+	csvOutput, err := newReporter(csvFormat, &output, reportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dupliCtx.Process(csvOutput, &noneAction{}, newScanMetadata([]string{"/"}, commons.SHA1Hash, &dirwalkerStatistics{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "group_id,hash,size,path,root,linked_to\n1,aaaa,4,/a/one,,\n1,aaaa,4,/b/one,,\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
+
+func TestReport_NDJSON_OneRecordPerFile(t *testing.T) {
+	dupliCtx := newTestContext(t, map[string]string{
+		"/a/one": "aaaa",
+		"/b/one": "aaaa",
+		"/a/two": "bbbbbb",
+		"/b/two": "bbbbbb",
+	})
+	output := bytes.Buffer{}
+
+	ndjsonOutput, err := newReporter(ndjsonFormat, &output, reportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dupliCtx.Process(ndjsonOutput, &noneAction{}, newScanMetadata([]string{"/"}, commons.SHA1Hash, &dirwalkerStatistics{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(lines))
+	}
+
+	record := fileRecord{}
+	err = json.Unmarshal([]byte(lines[3]), &record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if record.GroupID != 2 || record.Hash != "bbbbbb" || record.Path != "/b/two" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+}
+
+func TestReport_UnknownFormat_Error(t *testing.T) {
+	_, err := newReporter("xml", &bytes.Buffer{}, reportOptions{})
+	if err == nil {
+		t.Error("expected error for unknown format, got nil")
+	}
+}
+
+func TestReport_Fdupes_GroupsSeparatedByBlankLine(t *testing.T) {
+	dupliCtx := newTestContext(t, map[string]string{
+		"/a/one": "aaaa",
+		"/b/one": "aaaa",
+		"/a/two": "bbbbbb",
+		"/b/two": "bbbbbb",
+	})
+	output := bytes.Buffer{}
+
+	fdupesOutput, err := newReporter(fdupesFormat, &output, reportOptions{showSize: true, summarize: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dupliCtx.Process(fdupesOutput, &noneAction{}, newScanMetadata([]string{"/"}, commons.SHA1Hash, &dirwalkerStatistics{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "4 bytes each:\n/a/one\n/b/one\n\n6 bytes each:\n/a/two\n/b/two\n\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
+
+func TestReport_Fdupes_Summary(t *testing.T) {
+	dupliCtx := newTestContext(t, map[string]string{
+		"/a/one": "aaaa",
+		"/b/one": "aaaa",
+		"/c/one": "aaaa",
+		"/a/two": "bbbbbb",
+		"/b/two": "bbbbbb",
+	})
+	output := bytes.Buffer{}
+
+	fdupesOutput, err := newReporter(fdupesFormat, &output, reportOptions{showSize: false, summarize: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dupliCtx.Process(fdupesOutput, &noneAction{}, newScanMetadata([]string{"/"}, commons.SHA1Hash, &dirwalkerStatistics{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "3 duplicate files (in 2 sets), occupying 14 bytes.\n\n"
+	if output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
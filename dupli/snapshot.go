@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"archive-tools-monorepo/commons"
+	datastructures "archive-tools-monorepo/dataStructures"
+)
+
+const snapshotFormatVersion = 1
+
+// snapshotHeader is the first line of a snapshot, every following line is a
+// snapshotRecord carrying the full content hash of one file.
+type snapshotHeader struct {
+	Created       time.Time    `json:"created"`
+	Scan          scanMetadata `json:"scan"`
+	FormatVersion int          `json:"format_version"`
+}
+
+type snapshotRecord struct {
+	ModTime    time.Time `json:"mtime"`
+	ChangeTime time.Time `json:"ctime"`
+	Path       string    `json:"path"`
+	Root       string    `json:"root,omitempty"`
+	Links      []string  `json:"links,omitempty"`
+	Hash       string    `json:"hash"`
+	Size       int64     `json:"size"`
+	Device     uint64    `json:"dev"`
+	Inode      uint64    `json:"ino"`
+}
+
+// snapshotWriter fills a temporary file renamed over the snapshot path on
+// Close, an interrupted scan never leaves a truncated snapshot behind.
+type snapshotWriter struct {
+	file         *os.File
+	writer       *bufio.Writer
+	encoder      *json.Encoder
+	snapshotPath string
+}
+
+func createSnapshot(snapshotPath string, metadata scanMetadata) (*snapshotWriter, error) {
+	if snapshotPath == "" {
+		return nil, fmt.Errorf("%w: snapshot path is empty", os.ErrInvalid)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(snapshotPath), filepath.Base(snapshotPath)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("error while creating snapshot: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	snapshot := &snapshotWriter{
+		file:         file,
+		writer:       writer,
+		encoder:      json.NewEncoder(writer),
+		snapshotPath: snapshotPath,
+	}
+
+	err = snapshot.encoder.Encode(snapshotHeader{
+		Created:       time.Now().UTC(),
+		Scan:          metadata,
+		FormatVersion: snapshotFormatVersion,
+	})
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("error while writing snapshot: %w", err), snapshot.discard())
+	}
+
+	return snapshot, nil
+}
+
+func (snapshot *snapshotWriter) Write(file *commons.File) error {
+	err := snapshot.encoder.Encode(snapshotRecord{
+		ModTime:    file.ModTime,
+		ChangeTime: file.ChangeTime,
+		Path:       file.Name,
+		Root:       file.Root,
+		Links:      file.Links,
+		Hash:       file.Hash.Value(),
+		Size:       file.Size,
+		Device:     file.Device,
+		Inode:      file.Inode,
+	})
+	if err != nil {
+		return fmt.Errorf("error while writing snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (snapshot *snapshotWriter) Close() error {
+	err := snapshot.writer.Flush()
+	if err == nil {
+		err = snapshot.file.Sync()
+	}
+
+	if err != nil {
+		return errors.Join(fmt.Errorf("error while writing snapshot: %w", err), snapshot.discard())
+	}
+
+	err = snapshot.file.Close()
+	if err == nil {
+		err = os.Rename(snapshot.file.Name(), snapshot.snapshotPath)
+	}
+
+	if err != nil {
+		_ = os.Remove(snapshot.file.Name())
+		return fmt.Errorf("error while saving snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (snapshot *snapshotWriter) discard() error {
+	err := errors.Join(snapshot.file.Close(), os.Remove(snapshot.file.Name()))
+	if err != nil {
+		return fmt.Errorf("error while removing snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// loadSnapshot hands every file of the snapshot to fileFn, hashes are
+// interned in registry so files of several snapshots can share them.
+func loadSnapshot(
+	snapshotPath string,
+	registry *datastructures.Flyweight[string],
+	fileFn func(commons.File) error,
+) (snapshotHeader, error) {
+	header := snapshotHeader{}
+
+	file, err := os.Open(snapshotPath)
+	if err != nil {
+		return header, fmt.Errorf("error while opening snapshot: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	if !scanner.Scan() {
+		return header, fmt.Errorf("%w: %s is not a snapshot", os.ErrInvalid, snapshotPath)
+	}
+
+	err = json.Unmarshal(scanner.Bytes(), &header)
+	if err != nil || header.FormatVersion != snapshotFormatVersion {
+		return header, fmt.Errorf("%w: %s is not a supported snapshot", os.ErrInvalid, snapshotPath)
+	}
+
+	for scanner.Scan() {
+		record := snapshotRecord{}
+
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return header, fmt.Errorf("error while reading snapshot: %w", err)
+		}
+
+		hash, err := registry.Instance(record.Hash)
+		if err != nil {
+			return header, fmt.Errorf("%w", err)
+		}
+
+		err = fileFn(commons.File{
+			ModTime:    record.ModTime,
+			ChangeTime: record.ChangeTime,
+			Hash:       hash,
+			Name:       record.Path,
+			Root:       record.Root,
+			Links:      record.Links,
+			Size:       record.Size,
+			Device:     record.Device,
+			Inode:      record.Inode,
+		})
+		if err != nil {
+			return header, err
+		}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return header, fmt.Errorf("error while reading snapshot: %w", err)
+	}
+
+	return header, nil
+}
+
+// hashAllFiles drains the heap computing the stage hash of every file, not
+// only of the files sharing their size, and hands them to fileFn. Files that
+// can't be hashed are left out and logged through logFn.
+func (dupliCtx *DupliContext) hashAllFiles(
+	stage *hashStage,
+	fileFn func(*commons.File) error,
+	logFn func(string, ...any),
+) error {
+	fileChannel := make(chan commons.File)
+	result := make(chan error, 1)
+	failures := make([]unverifiedFile, 0)
+	failuresMutex := sync.Mutex{}
+
+	hashPool, err := commons.NewWorkerPool(func(file commons.File) error {
+		err := refineFile(file, fileChannel, dupliCtx, stage)
+		if err != nil {
+			failuresMutex.Lock()
+			failures = append(failures, unverifiedFile{Path: file.Name, Error: err.Error()})
+			failuresMutex.Unlock()
+		}
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+
+	go func() {
+		var err error
+
+		for file := range fileChannel {
+			if err == nil {
+				err = fileFn(&file)
+			}
+		}
+
+		result <- err
+	}()
+
+	total := float64(dupliCtx.heap.Size())
+	processed := 0.0
+
+	ui.AddNewNamedLine("snapshot-stage", "Hashing every file ... %.1f %%")
+
+	var popErr error
+
+	for !dupliCtx.heap.Empty() {
+		var file commons.File
+
+		file, popErr = dupliCtx.heap.Pop()
+		if popErr != nil {
+			popErr = fmt.Errorf("%w", popErr)
+			break
+		}
+
+		submitWhenIdle(hashPool, file)
+
+		processed += 1.0
+		ui.UpdateNamedLine("snapshot-stage", (processed/total)*100)
+	}
+
+	hashPool.Release()
+	close(fileChannel)
+
+	err = errors.Join(popErr, <-result)
+	if err != nil {
+		return err
+	}
+
+	for _, failure := range failures {
+		logFn("could not hash %s, left out of the snapshot: %s", failure.Path, failure.Error)
+	}
+
+	if len(failures) > 0 {
+		logFn("%d files could not be hashed and are missing from the snapshot", len(failures))
+	}
+
+	return nil
+}
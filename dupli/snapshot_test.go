@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"archive-tools-monorepo/commons"
+	datastructures "archive-tools-monorepo/dataStructures"
+)
+
+func TestSnapshot_WriteAndLoad_RoundTrip(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.db")
+	registry := datastructures.Flyweight[string]{}
+	modTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	hash, err := registry.Instance("cafe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := createSnapshot(snapshotPath, newScanMetadata([]string{"/data"}, commons.SHA256Hash, &dirwalkerStatistics{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/data/one", "/data/two"} {
+		err = snapshot.Write(&commons.File{Name: name, Size: 4, Hash: hash, ModTime: modTime, Device: 1, Inode: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = snapshot.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := make([]commons.File, 0)
+	otherRegistry := datastructures.Flyweight[string]{}
+
+	header, err := loadSnapshot(snapshotPath, &otherRegistry, func(file commons.File) error {
+		loaded = append(loaded, file)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Scan.HashAlgorithm != commons.SHA256Hash || len(header.Scan.Roots) != 1 || header.Scan.Roots[0] != "/data" {
+		t.Errorf("unexpected header %+v", header)
+	}
+
+	if len(loaded) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(loaded))
+	}
+
+	if loaded[0].Hash.Ptr() != loaded[1].Hash.Ptr() {
+		t.Error("expected loaded hashes to be interned")
+	}
+
+	if loaded[1].Name != "/data/two" || loaded[1].Hash.Value() != "cafe" || !loaded[1].ModTime.Equal(modTime) ||
+		loaded[1].Inode != 2 || loaded[1].Size != 4 {
+		t.Errorf("unexpected file %+v", loaded[1])
+	}
+}
+
+func TestSnapshot_LoadSnapshot_NotASnapshot(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "journal")
+
+	err := os.WriteFile(snapshotPath, []byte("{\"state\":\"done\"}\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = loadSnapshot(snapshotPath, &datastructures.Flyweight[string]{}, func(commons.File) error { return nil })
+	if err == nil {
+		t.Error("expected an error for a file without snapshot header")
+	}
+}
+
+func TestSnapshot_HashAllFiles_KeepsUniqueFiles(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{"only": "single"})
+
+	registry := datastructures.Flyweight[string]{}
+	hasher, err := commons.NewHasher(commons.SHA1Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dupliCtx, err := newDupliContext(
+		WithNewHeap(commons.StrongFileCompare),
+		WithExistingRegistry(&registry),
+		WithHasher(hasher),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emptyHash, err := registry.Instance("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"only", "missing"} {
+		err = dupliCtx.heap.Push(commons.File{Name: filepath.Join(baseDir, name), Size: 6, Hash: emptyHash})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hashed := make([]string, 0)
+	logged := make([]string, 0)
+	fullHash := hashStage{name: "full hash", blockSize: 0, reusedUpTo: 0}
+
+	err = dupliCtx.hashAllFiles(&fullHash, func(file *commons.File) error {
+		hashed = append(hashed, file.Hash.Value())
+		return nil
+	}, func(format string, arguments ...any) {
+		logged = append(logged, fmt.Sprintf(format, arguments...))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logged) != 2 || !strings.Contains(logged[0], filepath.Join(baseDir, "missing")) {
+		t.Errorf("expected the missing file to be reported, got %v", logged)
+	}
+
+	expected, err := hasher.HashFromPath(filepath.Join(baseDir, "only"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hashed) != 1 || hashed[0] != expected {
+		t.Errorf("expected [%s], got %v", expected, hashed)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+func ioctlTermios(fd uintptr, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return fmt.Errorf("%w", errno)
+	}
+
+	return nil
+}
+
+// enableKeystrokeMode turns off line buffering and echo on the terminal so
+// single keystrokes can be read, the returned function restores the
+// previous settings.
+func enableKeystrokeMode(fd uintptr) (func() error, error) {
+	original := syscall.Termios{}
+
+	err := ioctlTermios(fd, syscall.TCGETS, &original)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNoTerminal, err)
+	}
+
+	keystrokeMode := original
+	keystrokeMode.Lflag &^= syscall.ICANON | syscall.ECHO
+	keystrokeMode.Cc[syscall.VMIN] = 1
+	keystrokeMode.Cc[syscall.VTIME] = 0
+
+	err = ioctlTermios(fd, syscall.TCSETS, &keystrokeMode)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errNoTerminal, err)
+	}
+
+	return func() error {
+		return ioctlTermios(fd, syscall.TCSETS, &original)
+	}, nil
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+func enableKeystrokeMode(_ uintptr) (func() error, error) {
+	return nil, errNoTerminal
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"archive-tools-monorepo/commons"
+)
+
+var (
+	errNotReversible = errors.New("change can not be undone")
+	errNothingToUndo = errors.New("change is not on disk")
+	errNotAllUndone  = errors.New("some changes were not undone")
+)
+
+// undoJournal reverts the journaled changes, newest first. When operations
+// is not empty only entries for those operations are considered. Changes
+// that are no longer reversible are reported and left alone, the walk goes on
+// and errNotAllUndone is returned at the end.
+func undoJournal(journalPath string, operations []string, logFn func(string, ...any)) error {
+	entries, err := readJournal(journalPath)
+	if err != nil {
+		return err
+	}
+
+	undone := 0
+	notUndone := 0
+
+	for index := len(entries) - 1; index >= 0; index-- {
+		entry := &entries[index]
+
+		if entry.State == journalFailed {
+			continue
+		}
+
+		if len(operations) > 0 && !slices.Contains(operations, entry.Operation) {
+			continue
+		}
+
+		err = undoEntry(entry)
+
+		switch {
+		case errors.Is(err, errNothingToUndo) && entry.State == journalPending:
+			logFn("nothing to undo for %s of %s: change was interrupted before it happened", entry.Operation, entry.Target)
+		case err != nil:
+			notUndone++
+			logFn("cannot undo %s of %s: %v", entry.Operation, entry.Target, err)
+		default:
+			undone++
+			logFn("undone %s: %s", entry.Operation, entry.Target)
+		}
+	}
+
+	logFn("%d changes undone, %d changes not undone", undone, notUndone)
+
+	if notUndone > 0 {
+		return fmt.Errorf("%w: %d of %s", errNotAllUndone, notUndone, journalPath)
+	}
+
+	return nil
+}
+
+func undoEntry(entry *journalEntry) error {
+	if !filepath.IsAbs(entry.Source) || !filepath.IsAbs(entry.Target) {
+		return fmt.Errorf("%w: relative path recorded for %s", errNotReversible, entry.Target)
+	}
+
+	switch entry.Operation {
+	case removeOperation:
+		return undoRemove(entry)
+	case hardlinkActionName, symlinkActionName, reflinkActionName:
+		return undoLink(entry)
+	case quarantineActionName:
+		return undoQuarantine(entry)
+	default:
+		return fmt.Errorf("%w: unknown operation %s", errNotReversible, entry.Operation)
+	}
+}
+
+// checkSHA1 makes sure the content at filePath is still the one recorded in
+// the journal.
+func checkSHA1(filePath string, expected string) error {
+	hash, err := commons.GetSHA1HashFromPath(filePath)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotReversible, err)
+	}
+
+	if hash != expected {
+		return fmt.Errorf("%w: content of %s changed", errNotReversible, filePath)
+	}
+
+	return nil
+}
+
+// undoRemove recreates a removed duplicate from the kept file, which is
+// possible as long as the kept file still has the recorded content.
+func undoRemove(entry *journalEntry) error {
+	_, err := os.Lstat(entry.Target)
+	if err == nil {
+		return fmt.Errorf("%w: %s exists", errNothingToUndo, entry.Target)
+	}
+
+	err = checkSHA1(entry.Source, entry.SHA1)
+	if err != nil {
+		return err
+	}
+
+	err = copyFile(entry.Source, entry.Target)
+	if err != nil {
+		return err
+	}
+
+	return applyMetadata(entry.Target, &entry.Metadata)
+}
+
+// undoLink turns a linked or reflinked path back into an independent copy
+// of the kept file with its original metadata.
+func undoLink(entry *journalEntry) error {
+	targetInfo, err := os.Lstat(entry.Target)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotReversible, err)
+	}
+
+	sourceInfo, err := os.Stat(entry.Source)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errNotReversible, err)
+	}
+
+	switch entry.Operation {
+	case hardlinkActionName:
+		if !os.SameFile(targetInfo, sourceInfo) {
+			return fmt.Errorf("%w: %s is not linked to %s", errNothingToUndo, entry.Target, entry.Source)
+		}
+	case symlinkActionName:
+		if targetInfo.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("%w: %s is not a symlink", errNothingToUndo, entry.Target)
+		}
+	}
+
+	err = checkSHA1(entry.Source, entry.SHA1)
+	if err != nil {
+		return err
+	}
+
+	err = swapFile(entry.Target, func(temporaryPath string) error {
+		return copyFile(entry.Source, temporaryPath)
+	})
+	if err != nil {
+		return err
+	}
+
+	return applyMetadata(entry.Target, &entry.Metadata)
+}
+
+func undoQuarantine(entry *journalEntry) error {
+	_, err := os.Lstat(entry.Target)
+	if err != nil {
+		_, sourceErr := os.Lstat(entry.Source)
+		if sourceErr == nil {
+			return fmt.Errorf("%w: %s was not moved", errNothingToUndo, entry.Source)
+		}
+
+		return fmt.Errorf("%w: %w", errNotReversible, err)
+	}
+
+	err = checkSHA1(entry.Target, entry.SHA1)
+	if err != nil {
+		return err
+	}
+
+	return moveFile(entry.Target, entry.Source)
+}
+
+// applyMetadata restores mode and timestamps, ownership is restored only when
+// the process is allowed to.
+func applyMetadata(filePath string, metadata *fileMetadata) error {
+	err := os.Chmod(filePath, metadata.Mode.Perm())
+	if err != nil {
+		return fmt.Errorf("error while restoring mode: %w", err)
+	}
+
+	err = os.Chtimes(filePath, metadata.ModTime, metadata.ModTime)
+	if err != nil {
+		return fmt.Errorf("error while restoring timestamps: %w", err)
+	}
+
+	err = os.Lchown(filePath, int(metadata.UID), int(metadata.GID))
+	if err != nil && !errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("error while restoring owner: %w", err)
+	}
+
+	return nil
+}
+
+// restoreFromJournal moves every quarantined file recorded in the journal
+// back to its original path.
+func restoreFromJournal(journalPath string, logFn func(string, ...any)) error {
+	return undoJournal(journalPath, []string{quarantineActionName}, logFn)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func applyJournaledAction(t *testing.T, actionName string, group *duplicateGroup) string {
+	t.Helper()
+
+	journalPath := filepath.Join(t.TempDir(), "changes.journal")
+
+	changesJournal, err := newJournal(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configuration := newTestConfiguration(keepOldestFile, false)
+	configuration.journal = changesJournal
+
+	action, err := newGroupAction(actionName, configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = action.Apply(group)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = changesJournal.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return journalPath
+}
+
+func checkIndependentCopy(t *testing.T, keeperPath string, filePath string) {
+	t.Helper()
+
+	keeperInfo, err := os.Stat(keeperPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		t.Fatalf("%s was not restored: %v", filePath, err)
+	}
+
+	if !info.Mode().IsRegular() || os.SameFile(keeperInfo, info) {
+		t.Errorf("%s is not an independent copy", filePath)
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil || string(content) != "content" {
+		t.Errorf("%s content was not restored: %v", filePath, err)
+	}
+}
+
+func TestUndo_RevertsEveryReversibleAction(t *testing.T) {
+	for _, actionName := range []string{deleteActionName, hardlinkActionName, symlinkActionName} {
+		group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+		originalModTime := group.files[1].ModTime
+
+		err := os.Chmod(group.files[1].Name, 0o640)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.Chmod(group.files[0].Name, 0o640)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		journalPath := applyJournaledAction(t, actionName, group)
+
+		err = undoJournal(journalPath, nil, func(string, ...any) {})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkIndependentCopy(t, group.files[0].Name, group.files[1].Name)
+
+		info, err := os.Stat(group.files[1].Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != 0o640 || !info.ModTime().Equal(originalModTime) {
+			t.Errorf("%s: metadata not restored, got %s %s", actionName, info.Mode().Perm(), info.ModTime())
+		}
+	}
+}
+
+func TestUndo_KeptFileChanged_NotReversible(t *testing.T) {
+	group := newTestGroup(t, t.TempDir(), "a/file", "b/file")
+	journalPath := applyJournaledAction(t, deleteActionName, group)
+
+	err := os.WriteFile(group.files[0].Name, []byte("changed"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notReversible := 0
+	err = undoJournal(journalPath, nil, func(format string, _ ...any) {
+		if format == "cannot undo %s of %s: %v" {
+			notReversible++
+		}
+	})
+	if !errors.Is(err, errNotAllUndone) {
+		t.Errorf("expected not all undone error, got %v", err)
+	}
+
+	if notReversible != 1 {
+		t.Errorf("expected one change reported as not reversible, got %d", notReversible)
+	}
+
+	_, err = os.Stat(group.files[1].Name)
+	if err == nil {
+		t.Error("removed file recreated from changed content")
+	}
+}
+
+func TestUndo_RelativeRoots_UndoneFromAnyDirectory(t *testing.T) {
+	baseDir := t.TempDir()
+	changeDirectory(t, baseDir)
+
+	group := newTestGroup(t, ".", "a/file", "b/file")
+	journalPath := applyJournaledAction(t, deleteActionName, group)
+
+	changeDirectory(t, t.TempDir())
+
+	err := undoJournal(journalPath, nil, func(string, ...any) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkIndependentCopy(t, filepath.Join(baseDir, "a", "file"), filepath.Join(baseDir, "b", "file"))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"archive-tools-monorepo/commons"
+)
+
+const (
+	verifyChunkSize = 64 * 1024
+	// verifyOpenFiles bounds the files opened at once to compare a group, the
+	// pivot included.
+	verifyOpenFiles = 8
+)
+
+// verifiedGroup holds a hash group, the byte-identical sets its readable
+// members split into and the members that couldn't be read.
+type verifiedGroup struct {
+	group      duplicateGroup
+	subgroups  [][]commons.File
+	unreadable []unverifiedFile
+}
+
+func (verified *verifiedGroup) mismatch() bool {
+	return len(verified.subgroups) > 1
+}
+
+// splitByContent compares the files against a pivot, the first file not yet
+// placed, with at most verifyOpenFiles files open. Files matching the pivot
+// join its set, the others are compared again against the next pivot. Sets
+// are ordered by their first member, unreadable files are returned apart.
+func splitByContent(files []commons.File) ([][]commons.File, []unverifiedFile) {
+	subgroups := make([][]commons.File, 0, 1)
+	unreadable := make([]unverifiedFile, 0)
+	remaining := files
+
+	for len(remaining) > 0 {
+		pivot := remaining[0]
+		subgroup := []commons.File{pivot}
+		different := make([]commons.File, 0)
+		failures := make([]unverifiedFile, 0)
+
+		var pivotErr error
+
+		for start := 1; start < len(remaining); start += verifyOpenFiles - 1 {
+			batch := remaining[start:min(start+verifyOpenFiles-1, len(remaining))]
+
+			var same []bool
+			var errs []error
+
+			same, errs, pivotErr = compareWithPivot(pivot.Name, batch)
+			if pivotErr != nil {
+				break
+			}
+
+			for index := range batch {
+				switch {
+				case errs[index] != nil:
+					failures = append(failures, unverifiedFile{Path: batch[index].Name, Error: errs[index].Error()})
+				case same[index]:
+					subgroup = append(subgroup, batch[index])
+				default:
+					different = append(different, batch[index])
+				}
+			}
+		}
+
+		if pivotErr != nil {
+			unreadable = append(unreadable, unverifiedFile{Path: pivot.Name, Error: pivotErr.Error()})
+			remaining = remaining[1:]
+
+			continue
+		}
+
+		subgroups = append(subgroups, subgroup)
+		unreadable = append(unreadable, failures...)
+		remaining = different
+	}
+
+	return subgroups, unreadable
+}
+
+func readChunk(reader *os.File, buffer []byte) (int, error) {
+	count, err := io.ReadFull(reader, buffer)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, fmt.Errorf("error while verifying: %w", err)
+	}
+
+	return count, nil
+}
+
+// compareWithPivot streams the pivot and the batch side by side and tells
+// which members have the same bytes as the pivot. Errors of a member only
+// leave that member out, an error on the pivot fails the whole batch.
+func compareWithPivot(pivotPath string, batch []commons.File) ([]bool, []error, error) {
+	same := make([]bool, len(batch))
+	errs := make([]error, len(batch))
+	readers := make([]*os.File, len(batch))
+
+	defer func() {
+		for _, reader := range readers {
+			if reader != nil {
+				_ = reader.Close()
+			}
+		}
+	}()
+
+	pivot, err := os.Open(pivotPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while verifying: %w", err)
+	}
+	defer func() { _ = pivot.Close() }()
+
+	for index := range batch {
+		readers[index], errs[index] = os.Open(batch[index].Name)
+		same[index] = errs[index] == nil
+	}
+
+	pivotBuffer := make([]byte, verifyChunkSize)
+	buffer := make([]byte, verifyChunkSize)
+
+	for {
+		pivotCount, err := readChunk(pivot, pivotBuffer)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for index := range batch {
+			if !same[index] {
+				continue
+			}
+
+			count, err := readChunk(readers[index], buffer)
+			if err != nil {
+				errs[index] = err
+				same[index] = false
+
+				continue
+			}
+
+			same[index] = bytes.Equal(pivotBuffer[:pivotCount], buffer[:count])
+		}
+
+		if pivotCount < verifyChunkSize || !slices.Contains(same, true) {
+			return same, errs, nil
+		}
+	}
+}
+
+// verifyGroups compares the members of every group through the worker pool,
+// results keep the order of groups.
+func verifyGroups(groups []duplicateGroup) ([]verifiedGroup, error) {
+	results := make([]verifiedGroup, len(groups))
+
+	verifyPool, err := commons.NewWorkerPool(func(index int) error {
+		subgroups, unreadable := splitByContent(groups[index].files)
+		results[index] = verifiedGroup{group: groups[index], subgroups: subgroups, unreadable: unreadable}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+
+	ui.AddNewNamedLine("verify-stage", "Verifying groups content ... %.1f %%")
+
+	for index := range groups {
+		submitWhenIdle(verifyPool, index)
+
+		ui.UpdateNamedLine("verify-stage", float64(index+1)/float64(len(groups))*100)
+	}
+
+	verifyPool.Release()
+
+	return results, nil
+}
+
+// splitVerifiedGroups returns the byte-identical groups, numbered again, the
+// hash groups whose readable members turned out to differ and the files that
+// couldn't be read.
+func splitVerifiedGroups(results []verifiedGroup) ([]duplicateGroup, []duplicateGroup, []unverifiedFile) {
+	verified := make([]duplicateGroup, 0, len(results))
+	mismatches := make([]duplicateGroup, 0)
+	unreadable := make([]unverifiedFile, 0)
+
+	for index := range results {
+		unreadable = append(unreadable, results[index].unreadable...)
+
+		if results[index].mismatch() {
+			mismatch := results[index].group
+			mismatch.files = slices.Concat(results[index].subgroups...)
+			mismatches = append(mismatches, mismatch)
+		}
+
+		for _, files := range results[index].subgroups {
+			if len(files) < 2 {
+				continue
+			}
+
+			verified = append(verified, duplicateGroup{
+				hash:  results[index].group.hash,
+				files: files,
+				size:  results[index].group.size,
+				id:    len(verified) + 1,
+			})
+		}
+	}
+
+	for index := range mismatches {
+		mismatches[index].id = index + 1
+	}
+
+	return verified, mismatches, unreadable
+}
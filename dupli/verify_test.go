@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"archive-tools-monorepo/commons"
+	datastructures "archive-tools-monorepo/dataStructures"
+)
+
+func TestVerify_SplitByContent_DifferenceAfterFirstChunk(t *testing.T) {
+	original := make([]byte, verifyChunkSize+100)
+	changed := make([]byte, verifyChunkSize+100)
+	changed[verifyChunkSize+50] = 1
+
+	baseDir := writeTestTree(t, map[string]string{
+		"a": string(original), "b": string(changed), "c": string(original), "d": string(changed),
+	})
+	files := make([]commons.File, 0)
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		files = append(files, commons.File{Name: filepath.Join(baseDir, name), Size: int64(len(original))})
+	}
+
+	subgroups, unreadable := splitByContent(files)
+	if len(unreadable) != 0 {
+		t.Fatalf("expected every file read, got %v", unreadable)
+	}
+
+	if len(subgroups) != 2 {
+		t.Fatalf("expected 2 subgroups, got %d", len(subgroups))
+	}
+
+	expected := [][]string{
+		{filepath.Join(baseDir, "a"), filepath.Join(baseDir, "c")},
+		{filepath.Join(baseDir, "b"), filepath.Join(baseDir, "d")},
+	}
+	for index := range expected {
+		if len(subgroups[index]) != 2 ||
+			subgroups[index][0].Name != expected[index][0] || subgroups[index][1].Name != expected[index][1] {
+			t.Errorf("subgroup %d: expected %v, got %v", index, expected[index], subgroups[index])
+		}
+	}
+}
+
+func TestVerify_ProcessVerified_MismatchReportedApart(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{
+		"same1": "same",
+		"same2": "same",
+		"diff1": "abcd",
+		"diff2": "wxyz",
+	})
+
+	registry := datastructures.Flyweight[string]{}
+	dupliCtx, err := newDupliContext(
+		WithNewHeap(commons.StrongFileCompare),
+		WithExistingRegistry(&registry),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := map[string]string{"same1": "aaaa", "same2": "aaaa", "diff1": "bbbb", "diff2": "bbbb"}
+	for name, hash := range hashes {
+		hashPointer, err := registry.Instance(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = dupliCtx.heap.Push(commons.File{Name: filepath.Join(baseDir, name), Size: 4, Hash: hashPointer})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var output bytes.Buffer
+	jsonOutput, err := newReporter(jsonFormat, &output, reportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = dupliCtx.ProcessVerified(
+		jsonOutput, &noneAction{}, newScanMetadata([]string{"/"}, "", &dirwalkerStatistics{}), func(string, ...any) {},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := struct {
+		Groups     []jsonGroup `json:"groups"`
+		Mismatches []jsonGroup `json:"mismatches"`
+	}{}
+
+	err = json.Unmarshal(output.Bytes(), &report)
+	if err != nil {
+		t.Fatalf("invalid json %q: %v", output.String(), err)
+	}
+
+	if len(report.Groups) != 1 || report.Groups[0].Hash != "aaaa" || report.Groups[0].ID != 1 {
+		t.Errorf("expected only the aaaa group, got %+v", report.Groups)
+	}
+
+	if len(report.Mismatches) != 1 || report.Mismatches[0].Hash != "bbbb" || len(report.Mismatches[0].Files) != 2 {
+		t.Errorf("expected the bbbb group as mismatch, got %+v", report.Mismatches)
+	}
+}
+
+func TestVerify_SplitByContent_ManyFilesInBatches(t *testing.T) {
+	contents := make(map[string]string)
+	for index := range 3*verifyOpenFiles + 2 {
+		contents[fmt.Sprintf("f%02d", index)] = "same"
+	}
+
+	contents["f05"] = "diff"
+	contents["f20"] = "diff"
+
+	baseDir := writeTestTree(t, contents)
+	files := make([]commons.File, 0, len(contents))
+
+	for index := range len(contents) {
+		files = append(files, commons.File{Name: filepath.Join(baseDir, fmt.Sprintf("f%02d", index)), Size: 4})
+	}
+
+	subgroups, unreadable := splitByContent(files)
+	if len(unreadable) != 0 {
+		t.Fatalf("expected every file read, got %v", unreadable)
+	}
+
+	if len(subgroups) != 2 || len(subgroups[0]) != len(files)-2 ||
+		subgroups[1][0].Name != filepath.Join(baseDir, "f05") || subgroups[1][1].Name != filepath.Join(baseDir, "f20") {
+		t.Errorf("expected the same files and the two different ones apart, got %v", subgroups)
+	}
+}
+
+func TestVerify_SplitByContent_UnreadableFilesApart(t *testing.T) {
+	baseDir := writeTestTree(t, map[string]string{"b": "same", "d": "same"})
+	files := []commons.File{
+		{Name: filepath.Join(baseDir, "b") + "-missing-pivot", Size: 4},
+		{Name: filepath.Join(baseDir, "b"), Size: 4},
+		{Name: filepath.Join(baseDir, "b") + "-missing", Size: 4},
+		{Name: filepath.Join(baseDir, "d"), Size: 4},
+	}
+
+	results := []verifiedGroup{{group: duplicateGroup{files: files}, subgroups: nil, unreadable: nil}}
+	results[0].subgroups, results[0].unreadable = splitByContent(files)
+
+	verified, mismatches, unreadable := splitVerifiedGroups(results)
+
+	if len(verified) != 1 || len(verified[0].files) != 2 || len(mismatches) != 0 {
+		t.Errorf("expected one verified group and no mismatch, got %v and %v", verified, mismatches)
+	}
+
+	if len(unreadable) != 2 || unreadable[0].Path != files[0].Name || unreadable[1].Path != files[2].Name {
+		t.Errorf("expected both missing files reported, got %v", unreadable)
+	}
+}